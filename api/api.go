@@ -0,0 +1,292 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"sol_block_extractord/log"
+	"sol_block_extractord/postgres"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// Store is what the API reads, implemented by postgres.Query.
+type Store interface {
+	OperationsBySignature(signature string) ([]postgres.StoredOperation, error)
+	Operations(f postgres.OperationFilter) ([]postgres.StoredOperation, error)
+	Tick(tick string) (postgres.TickInfo, error)
+	Balances(address string) ([]postgres.Balance, error)
+}
+
+type Operation struct {
+	ID          int64  `json:"id"`
+	TxHash      string `json:"txHash"`
+	InstIndex   int    `json:"instIndex"`
+	BlockHeight uint64 `json:"blockHeight"`
+	BlockTime   int64  `json:"blockTime"`
+	TxIndex     int    `json:"txIndex"`
+	P           string `json:"p"`
+	Op          string `json:"op"`
+	Tick        string `json:"tick"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Amt         string `json:"amt,omitempty"`
+	Lim         string `json:"lim,omitempty"`
+	Max         string `json:"max,omitempty"`
+	Price       string `json:"price,omitempty"`
+	Listing     string `json:"listing,omitempty"`
+	Lamports    string `json:"lamports"`
+	Memo        string `json:"memo"`
+	Provisional bool   `json:"provisional"` // its block is only confirmed, it may be rolled back
+}
+
+type OperationsPage struct {
+	Operations []Operation `json:"operations"`
+	Next       string      `json:"next,omitempty"` // the cursor of the next page, empty on the last one
+}
+
+type TickInfo struct {
+	Tick        string     `json:"tick"`
+	Deploy      *Operation `json:"deploy"`
+	Max         int64      `json:"max"`
+	Minted      int64      `json:"minted"`
+	Burned      int64      `json:"burned"`
+	Circulating int64      `json:"circulating"`
+	Holders     int        `json:"holders"`
+}
+
+type Balance struct {
+	Tick   string `json:"tick"`
+	Amount int64  `json:"amount"`
+}
+
+type Status struct {
+	Slot uint64 `json:"slot"` // the last slot indexed, see progress
+	Head uint64 `json:"head"`
+	Lag  uint64 `json:"lag"`
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// Server serves the indexed data:
+//
+//	GET /operations/{signature}
+//	GET /operations?address=&tick=&op=&cursor=&limit=
+//	GET /ticks/{tick}
+//	GET /balances/{address}
+//	GET /status
+type Server struct {
+	store    Store
+	progress func() (uint64, error) // the last slot indexed
+	head     func() (uint64, error) // the chain head, the status has no lag when nil
+	mux      *http.ServeMux
+}
+
+func New(store Store, progress, head func() (uint64, error)) *Server {
+	s := &Server{store: store, progress: progress, head: head, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/operations", s.operations)
+	s.mux.HandleFunc("/operations/", s.operationsBySignature)
+	s.mux.HandleFunc("/ticks/", s.tick)
+	s.mux.HandleFunc("/balances/", s.balances)
+	s.mux.HandleFunc("/status", s.status)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only GET is supported"))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Logger.Warn("api write response failed", zap.Error(err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	if status == http.StatusInternalServerError {
+		log.Logger.Error("api request failed", zap.Error(err))
+		err = errors.New("internal error")
+	}
+	writeJSON(w, status, errorBody{Error: err.Error()})
+}
+
+// pathParam is the single path segment after prefix.
+func pathParam(r *http.Request, prefix string) (string, bool) {
+	param := strings.TrimPrefix(r.URL.Path, prefix)
+	return param, param != "" && !strings.Contains(param, "/")
+}
+
+func toOperation(op postgres.StoredOperation) Operation {
+	lamports := "0"
+	if op.Value != nil {
+		lamports = op.Value.Dec()
+	}
+	return Operation{
+		ID:          op.ID,
+		TxHash:      op.TxHash,
+		InstIndex:   op.InstIdx,
+		BlockHeight: op.BlockHeight,
+		BlockTime:   op.BlockTimeSec,
+		TxIndex:     op.TxIdx,
+		P:           op.M.P,
+		Op:          op.M.Op,
+		Tick:        op.M.Tick,
+		From:        op.From,
+		To:          op.To,
+		Amt:         op.M.Amt,
+		Lim:         op.M.Lim,
+		Max:         op.M.Max,
+		Price:       op.M.Price,
+		Listing:     op.M.Listing,
+		Lamports:    lamports,
+		Memo:        op.MemoRaw,
+		Provisional: op.Provisional,
+	}
+}
+
+func (s *Server) operationsBySignature(w http.ResponseWriter, r *http.Request) {
+	signature, ok := pathParam(r, "/operations/")
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	ops, err := s.store.OperationsBySignature(signature)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(ops) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no operation in tx %s", signature))
+		return
+	}
+
+	page := OperationsPage{Operations: make([]Operation, len(ops))}
+	for i, op := range ops {
+		page.Operations[i] = toOperation(op)
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) operations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	// the ticks are stored uppercased
+	f := postgres.OperationFilter{Address: query.Get("address"), Tick: strings.ToUpper(query.Get("tick")), Op: query.Get("op"), Limit: defaultLimit}
+
+	var err error
+	if cursor := query.Get("cursor"); cursor != "" {
+		c, err := postgres.ParseCursor(cursor)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid cursor %q", cursor))
+			return
+		}
+		f.Cursor = &c
+	}
+	if limit := query.Get("limit"); limit != "" {
+		f.Limit, err = strconv.Atoi(limit)
+		if err != nil || f.Limit <= 0 || f.Limit > maxLimit {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("limit must be in [1, %d], got %q", maxLimit, limit))
+			return
+		}
+	}
+
+	ops, err := s.store.Operations(f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := OperationsPage{Operations: make([]Operation, len(ops))}
+	for i, op := range ops {
+		page.Operations[i] = toOperation(op)
+	}
+	if len(ops) == f.Limit {
+		page.Next = ops[len(ops)-1].Cursor().String()
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) tick(w http.ResponseWriter, r *http.Request) {
+	tick, ok := pathParam(r, "/ticks/")
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	tick = strings.ToUpper(tick)
+
+	info, err := s.store.Tick(tick)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if info.Deploy == nil && info.Minted == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("tick %s not found", tick))
+		return
+	}
+
+	body := TickInfo{Tick: info.Tick, Minted: info.Minted, Burned: info.Burned, Circulating: info.Minted - info.Burned, Holders: info.Holders}
+	if info.Deploy != nil {
+		deploy := toOperation(*info.Deploy)
+		body.Deploy = &deploy
+		body.Max = info.Deploy.M.MaxN
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (s *Server) balances(w http.ResponseWriter, r *http.Request) {
+	address, ok := pathParam(r, "/balances/")
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	balances, err := s.store.Balances(address)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	body := make([]Balance, len(balances))
+	for i, b := range balances {
+		body[i] = Balance{Tick: b.Tick, Amount: b.Amount}
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	slot, err := s.progress()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	status := Status{Slot: slot}
+	if s.head != nil {
+		status.Head, err = s.head()
+		if err != nil {
+			writeError(w, http.StatusBadGateway, fmt.Errorf("get chain head: %w", err))
+			return
+		}
+		if status.Head > slot {
+			status.Lag = status.Head - slot
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
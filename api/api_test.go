@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	"sol_block_extractord/postgres"
+	"sol_block_extractord/types"
+)
+
+type store struct {
+	ops      []postgres.StoredOperation // by id, not in chain order
+	balances map[string][]postgres.Balance
+	slot     uint64
+}
+
+func (s *store) OperationsBySignature(signature string) (ops []postgres.StoredOperation, err error) {
+	for _, op := range s.ops {
+		if op.TxHash == signature {
+			ops = append(ops, op)
+		}
+	}
+	return
+}
+
+func before(a, b postgres.Cursor) bool {
+	if a.BlockHeight != b.BlockHeight {
+		return a.BlockHeight < b.BlockHeight
+	}
+	if a.TxIdx != b.TxIdx {
+		return a.TxIdx < b.TxIdx
+	}
+	return a.InstIdx < b.InstIdx
+}
+
+func (s *store) Operations(f postgres.OperationFilter) (ops []postgres.StoredOperation, err error) {
+	sorted := append([]postgres.StoredOperation(nil), s.ops...)
+	sort.Slice(sorted, func(i, j int) bool { return before(sorted[j].Cursor(), sorted[i].Cursor()) })
+	for _, op := range sorted {
+		if len(ops) == f.Limit {
+			break
+		}
+		if (f.Cursor == nil || before(op.Cursor(), *f.Cursor)) && (f.Address == "" || op.From == f.Address || op.To == f.Address) && (f.Tick == "" || op.M.Tick == f.Tick) {
+			ops = append(ops, op)
+		}
+	}
+	return
+}
+
+func (s *store) Tick(tick string) (info postgres.TickInfo, err error) {
+	info.Tick = tick
+	for i, op := range s.ops {
+		if op.M.Tick != tick {
+			continue
+		}
+		switch op.M.Op {
+		case types.OpDeploy:
+			info.Deploy = &s.ops[i]
+		case types.OpMint:
+			info.Minted += op.M.AmtN
+		}
+	}
+	info.Holders = 1
+	return
+}
+
+func (s *store) Balances(address string) ([]postgres.Balance, error) {
+	if address == "broken" {
+		return nil, errors.New("db down")
+	}
+	return s.balances[address], nil
+}
+
+func (s *store) progress() (uint64, error) {
+	return s.slot, nil
+}
+
+func newStore() *store {
+	s := &store{balances: map[string][]postgres.Balance{"a": {{Tick: "TEST", Amount: 30}}}, slot: 90}
+	add := func(op types.Operation) {
+		op.Value = uint256.NewInt(0)
+		s.ops = append(s.ops, postgres.StoredOperation{ID: int64(len(s.ops) + 1), Operation: op})
+	}
+	add(types.Operation{TxHash: "deploy", BlockHeight: 10, From: "d", M: types.Memo{Op: types.OpDeploy, Tick: "TEST", Max: "1000", MaxN: 1000}})
+	for i := 0; i < 4; i++ {
+		add(types.Operation{TxHash: "mint" + string(rune('0'+i)), BlockHeight: 20, TxIdx: i, From: "a", M: types.Memo{Op: types.OpMint, Tick: "TEST", Amt: "10", AmtN: 10}})
+	}
+	// backfilled, stored after the later ones
+	add(types.Operation{TxHash: "mint4", BlockHeight: 15, From: "a", M: types.Memo{Op: types.OpMint, Tick: "TEST", Amt: "10", AmtN: 10}})
+	return s
+}
+
+func get(t *testing.T, s *Server, url string, status int, v interface{}) {
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	require.Equal(t, status, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+}
+
+func TestOperations(t *testing.T) {
+	st := newStore()
+	s := New(st, st.progress, nil)
+
+	var page OperationsPage
+	get(t, s, "/operations/mint2", http.StatusOK, &page)
+	require.Len(t, page.Operations, 1)
+	require.Equal(t, int64(4), page.Operations[0].ID)
+	require.Equal(t, "0", page.Operations[0].Lamports)
+
+	var e errorBody
+	get(t, s, "/operations/nope", http.StatusNotFound, &e)
+
+	var ids []int64
+	url := "/operations?address=a&limit=2"
+	for {
+		page = OperationsPage{}
+		get(t, s, url, http.StatusOK, &page)
+		for _, op := range page.Operations {
+			ids = append(ids, op.ID)
+		}
+		if page.Next == "" {
+			break
+		}
+		url = "/operations?address=a&limit=2&cursor=" + page.Next
+	}
+	require.Equal(t, []int64{5, 4, 3, 2, 6}, ids)
+
+	get(t, s, "/operations?cursor=x", http.StatusBadRequest, &e)
+	get(t, s, "/operations?cursor=20-1", http.StatusBadRequest, &e)
+	get(t, s, "/operations?limit=501", http.StatusBadRequest, &e)
+	require.Contains(t, e.Error, "limit must be in [1, 500]")
+}
+
+func TestTickAndBalances(t *testing.T) {
+	st := newStore()
+	s := New(st, st.progress, func() (uint64, error) { return 100, nil })
+
+	var info TickInfo
+	get(t, s, "/ticks/TEST", http.StatusOK, &info)
+	require.Equal(t, int64(1000), info.Max)
+	require.Equal(t, int64(50), info.Minted)
+	require.Equal(t, int64(50), info.Circulating)
+	require.Equal(t, "deploy", info.Deploy.TxHash)
+
+	var e errorBody
+	get(t, s, "/ticks/NONE", http.StatusNotFound, &e)
+	// the ticks are uppercased when parsed
+	get(t, s, "/ticks/test", http.StatusOK, &info)
+	require.Equal(t, "TEST", info.Tick)
+
+	var balances []Balance
+	get(t, s, "/balances/a", http.StatusOK, &balances)
+	require.Equal(t, []Balance{{Tick: "TEST", Amount: 30}}, balances)
+	get(t, s, "/balances/b", http.StatusOK, &balances)
+	require.Empty(t, balances)
+	get(t, s, "/balances/broken", http.StatusInternalServerError, &e)
+	require.Equal(t, "internal error", e.Error)
+
+	var status Status
+	get(t, s, "/status", http.StatusOK, &status)
+	require.Equal(t, Status{Slot: 90, Head: 100, Lag: 10}, status)
+}
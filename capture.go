@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+
+	"sol_block_extractord/config"
+	"sol_block_extractord/finished_block_manager"
+	"sol_block_extractord/fixture"
+	"sol_block_extractord/log"
+	"sol_block_extractord/postgres"
+	"sol_block_extractord/sink"
+	"sol_block_extractord/source"
+)
+
+// capture saves the finalized blocks of the slots to dir as the RPC returns
+// them, for replay to index them offline.
+func capture(c *cli.Context) error {
+	dir := c.String("dir")
+	slots, err := fixture.ParseSlots(c.String("slots"))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	src := newRPC()
+	for _, slot := range slots {
+		result, err := src.RawBlock(ctx, slot, rpc.CommitmentFinalized)
+		if err != nil {
+			return fmt.Errorf("getBlock %d: %w", slot, err)
+		}
+		if err := fixture.Save(dir, slot, result); err != nil {
+			return err
+		}
+		log.Logger.Info("block captured", zap.Uint64("slot", slot), zap.Bool("skipped", result == nil), zap.String("path", fixture.Path(dir, slot)))
+	}
+	return nil
+}
+
+// replay indexes the blocks captured in dir to the sinks in slot order, like
+// backfill without the RPC.
+func replay(c *cli.Context) error {
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	src := source.NewFile(c.String("dir"))
+	head, err := src.Head(ctx, rpc.CommitmentFinalized)
+	if err != nil {
+		return err
+	}
+	slots, err := src.Slots(ctx, 0, head, rpc.CommitmentFinalized)
+	if err != nil {
+		return err
+	}
+
+	if config.Cfg.UsesPostgres() {
+		if err := prepareSchema(c); err != nil {
+			return err
+		}
+		rulesLog, err := postgres.NewRulesLog()
+		if err != nil {
+			return err
+		}
+		err = loadRules(rulesLog)
+		rulesLog.Shutdown()
+		if err != nil {
+			return err
+		}
+	}
+
+	s, err := openSinks(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	opsCh := make(chan sink.Block, 1000)
+	postDone := make(chan struct{})
+	var postErr error
+	go func() {
+		postErr = sink.PostOperations(s, opsCh, nil, nil)
+		close(postDone)
+	}()
+
+	blockCh := make(chan SlotBlock, 100)
+	loadErr := make(chan error, 1)
+	go func() {
+		defer close(blockCh)
+		loadErr <- loadBlocks(ctx, src, slots, blockCh)
+	}()
+
+	tracker := finished_block_manager.NewMemoryTracker(slots[0])
+	err = processBlocks(ctx, blockCh, opsCh, postDone, tracker)
+	stop() // unblocks loadBlocks if processBlocks returned early
+	if lerr := <-loadErr; err == nil {
+		err = lerr
+	}
+
+	close(opsCh)
+	<-postDone
+	if err == nil {
+		err = postErr
+	}
+	if err != nil {
+		return err
+	}
+	log.Logger.Info("replay done", zap.Uint64("from", slots[0]), zap.Uint64("to", slots[len(slots)-1]), zap.Int("slots", len(slots)))
+	return nil
+}
+
+// loadBlocks hands blockCh the blocks of the slots in order, leaving out the
+// skipped ones. Unlike SOLSyncBlocks, it doesn't wait for the parent slot of a
+// block, which a capture may not have.
+func loadBlocks(ctx context.Context, src source.BlockSource, slots []uint64, blockCh chan SlotBlock) error {
+	for _, slot := range slots {
+		b, err := src.Block(ctx, slot, rpc.CommitmentFinalized)
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			continue
+		}
+		select {
+		case blockCh <- SlotBlock{Slot: slot, GetBlockResult: b}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
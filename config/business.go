@@ -1,15 +1,77 @@
 package config
 
 type Business struct {
-	DeployHeight       uint64
+	DeployHeight       uint64 `yaml:"deployHeight"`
+	OpenMintHeight     uint64 `yaml:"openMintHeight"`
+	OpenTransferHeight uint64 `yaml:"openTransferHeight"`
+
+	// fair launch rules, zero disables a rule
+	CloseMintHeight uint64 `yaml:"closeMintHeight"` // mint closes from this height on
+	MintCapPerAddr  int64  `yaml:"mintCapPerAddr"`  // total amt an address may mint
+	MintCapPerSlot  int64  `yaml:"mintCapPerSlot"`  // total amt that may be minted in a slot
+
+	FreeMint    bool   `yaml:"freeMint"`
+	ToAddrLimit string `yaml:"toAddrLimit"`
+
+	MemoLenMin int `yaml:"memoLenMin"`
+	MemoLenMax int `yaml:"memoLenMax"`
+
+	Ins Inscription `yaml:"inscription"`
+
+	// EffectiveSlot is the slot a reloaded file takes effect from, the next
+	// slot to be indexed when it's 0 or already indexed.
+	EffectiveSlot uint64 `yaml:"effectiveSlot" json:"-"`
+}
+
+// Rules are the business values that can be reloaded at runtime. The deploy
+// height is tracked by the indexer, and the inscription and free mint change
+// how memos are parsed, so they are fixed for the process lifetime.
+type Rules struct {
 	OpenMintHeight     uint64
 	OpenTransferHeight uint64
+	CloseMintHeight    uint64
+	MintCapPerAddr     int64
+	MintCapPerSlot     int64
+	ToAddrLimit        string
+	MemoLenMin         int
+	MemoLenMax         int
+}
+
+func (b Business) Rules() Rules {
+	return Rules{
+		OpenMintHeight:     b.OpenMintHeight,
+		OpenTransferHeight: b.OpenTransferHeight,
+		CloseMintHeight:    b.CloseMintHeight,
+		MintCapPerAddr:     b.MintCapPerAddr,
+		MintCapPerSlot:     b.MintCapPerSlot,
+		ToAddrLimit:        b.ToAddrLimit,
+		MemoLenMin:         b.MemoLenMin,
+		MemoLenMax:         b.MemoLenMax,
+	}
+}
 
-	FreeMint    bool
-	ToAddrLimit string
+func (b *Business) SetRules(r Rules) {
+	b.OpenMintHeight = r.OpenMintHeight
+	b.OpenTransferHeight = r.OpenTransferHeight
+	b.CloseMintHeight = r.CloseMintHeight
+	b.MintCapPerAddr = r.MintCapPerAddr
+	b.MintCapPerSlot = r.MintCapPerSlot
+	b.ToAddrLimit = r.ToAddrLimit
+	b.MemoLenMin = r.MemoLenMin
+	b.MemoLenMax = r.MemoLenMax
+}
 
-	MemoLenMin int
-	MemoLenMax int
+func (r Rules) Validate() error {
+	var p problems
+	r.check(&p)
+	return p.err()
+}
 
-	Inscription Inscription
+func (r Rules) check(p *problems) {
+	p.check(r.MemoLenMax == 0 || r.MemoLenMax >= r.MemoLenMin,
+		"business memoLenMax %d < memoLenMin %d", r.MemoLenMax, r.MemoLenMin)
+	p.check(r.CloseMintHeight == 0 || r.CloseMintHeight > r.OpenMintHeight,
+		"business closeMintHeight %d <= openMintHeight %d", r.CloseMintHeight, r.OpenMintHeight)
+	p.check(r.MintCapPerAddr >= 0, "business mintCapPerAddr is negative")
+	p.check(r.MintCapPerSlot >= 0, "business mintCapPerSlot is negative")
 }
@@ -2,15 +2,70 @@ package config
 
 import (
 	"encoding/json"
-	"gopkg.in/yaml.v3"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ProgressMemory   = "memory"
+	ProgressPostgres = "postgres"
 )
 
 type Config struct {
-	Postgres  Postgres
-	Business  Business
-	StartSlot uint64
-	Workers   uint
+	Pg              Postgres   `yaml:"postgres"`
+	Biz             Business   `yaml:"business"`
+	StartSlot       uint64     `yaml:"startSlot"`
+	BlockWorkers    int        `yaml:"workers"`
+	ProgressBackend string     `yaml:"progressBackend"`
+	RPC             RPC        `yaml:"rpc"`
+	Ingestion       string     `yaml:"ingestion"` // rpc, geyser or signatures, rpc when empty
+	Geyser          Geyser     `yaml:"geyser"`
+	Signatures      Signatures `yaml:"signatures"`
+
+	Sinks  string `yaml:"sinks"` // comma separated: postgres, sqlite, jsonl, kafka; the first one rebuilds the ledger on start
+	SQLite SQLite `yaml:"sqlite"`
+	JSONL  JSONL  `yaml:"jsonl"`
+	Kafka  Kafka  `yaml:"kafka"`
+
+	Webhooks []Webhook `yaml:"webhooks"`
+
+	API     API     `yaml:"api"`
+	Metrics Metrics `yaml:"metrics"`
+	Health  Health  `yaml:"health"`
+	Log     Log     `yaml:"log"`
+}
+
+type Metrics struct {
+	Listen string `yaml:"listen"` // host:port of the start command /metrics, /healthz and /readyz, empty to disable
+}
+
+type Health struct {
+	StallWindow time.Duration `yaml:"stallWindow"` // unhealthy when the finished slot doesn't move for longer, 0 to disable
+	MaxLag      uint64        `yaml:"maxLag"`      // unhealthy when more slots behind the head, 0 to disable
+}
+
+type API struct {
+	Listen string `yaml:"listen"` // host:port of the serve command
+}
+
+var sslModes = map[string]bool{"disable": true, "require": true, "verify-ca": true, "verify-full": true}
+
+// LoadSecrets reads the secrets given as files.
+func (c *Config) LoadSecrets() error {
+	for i := range c.Webhooks {
+		if err := c.Webhooks[i].LoadSecrets(); err != nil {
+			return err
+		}
+	}
+	if err := c.Geyser.LoadSecrets(); err != nil {
+		return err
+	}
+	return c.Pg.LoadSecrets()
 }
 
 func (c *Config) ToString() string {
@@ -18,17 +73,106 @@ func (c *Config) ToString() string {
 	return string(bytes)
 }
 
-var GConfig Config
+type problems []string
+
+func (p *problems) check(ok bool, format string, args ...interface{}) {
+	if !ok {
+		*p = append(*p, fmt.Sprintf(format, args...))
+	}
+}
+
+func (p problems) err() error {
+	if len(p) != 0 {
+		return errors.New("invalid config:\n  - " + strings.Join(p, "\n  - "))
+	}
+	return nil
+}
+
+// Validate reports every problem of the merged config at once.
+func (c *Config) Validate() error {
+	var p problems
+	check := p.check
+
+	check(c.BlockWorkers > 0, "workers must be positive, got %d", c.BlockWorkers)
+	check(c.ProgressBackend == ProgressMemory || c.ProgressBackend == ProgressPostgres,
+		"progressBackend must be %s or %s, got %q", ProgressMemory, ProgressPostgres, c.ProgressBackend)
+
+	c.checkRPC(&p)
+	c.checkIngestion(&p)
+
+	kinds := make(map[string]bool)
+	for i, kind := range c.SinkKinds() {
+		check(kind == SinkPostgres || kind == SinkSQLite || kind == SinkJSONL || kind == SinkKafka,
+			"sink must be %s, %s, %s or %s, got %q", SinkPostgres, SinkSQLite, SinkJSONL, SinkKafka, kind)
+		check(!kinds[kind], "sink %s given twice", kind)
+		check(i != 0 || kind != SinkKafka, "sink kafka can't be the first one, it can't rebuild the ledger")
+		kinds[kind] = true
+	}
+	check(!kinds[SinkSQLite] || c.SQLite.Path != "", "sqlite path is empty")
+	check(!kinds[SinkJSONL] || c.JSONL.Dir != "", "jsonl dir is empty")
+	check(!kinds[SinkKafka] || (c.Kafka.Brokers != "" && c.Kafka.Topic != ""), "kafka brokers or topic is empty")
+
+	webhooks := make(map[string]bool)
+	for i := range c.Webhooks {
+		c.Webhooks[i].check(&p)
+		check(!webhooks[c.Webhooks[i].Name], "webhook %s defined twice", c.Webhooks[i].Name)
+		webhooks[c.Webhooks[i].Name] = true
+	}
+
+	if c.UsesPostgres() {
+		if c.Pg.URL == "" {
+			check(c.Pg.Host != "", "postgres host is empty")
+			check(c.Pg.Port > 0 && c.Pg.Port < 65536, "postgres port %d out of range", c.Pg.Port)
+			check(c.Pg.User != "", "postgres user is empty")
+			check(c.Pg.DbName != "", "postgres db is empty")
+		} else {
+			_, err := c.Pg.DataSource()
+			check(err == nil, "%v", err)
+		}
+		check(c.Pg.SSLMode == "" || sslModes[c.Pg.SSLMode], "postgres sslmode %q not supported", c.Pg.SSLMode)
+	}
+	check(c.Pg.BatchSize > 0, "postgres batchSize must be positive, got %d", c.Pg.BatchSize)
+	check(c.Pg.BatchInterval > 0, "postgres batchInterval must be positive, got %v", c.Pg.BatchInterval)
+	check(c.Health.StallWindow >= 0, "health stallWindow must not be negative, got %v", c.Health.StallWindow)
+
+	c.Log.check(&p)
+
+	check(c.Biz.Ins.P != "", "business inscription p is empty")
+	check(c.Biz.Ins.Tick != "", "business inscription tick is empty")
+	c.Biz.Rules().check(&p)
+
+	names := make(map[string]bool)
+	for i, op := range c.Biz.Ins.Ops {
+		check(op.Name != "", "business inscription ops[%d] has no name", i)
+		check(!names[op.Name], "business inscription op %s defined twice", op.Name)
+		names[op.Name] = true
+	}
+
+	return p.err()
+}
+
+var Cfg Config
 
-func LoadFromFile(path string) (err error) {
-	bytes, err := os.ReadFile(path)
+// LoadFromFile reads the YAML config at path into Cfg, keeping the current
+// values of the keys the file doesn't set.
+func LoadFromFile(path string) error {
+	return DecodeFile(path, &Cfg)
+}
+
+// DecodeFile reads the YAML config at path into c, keeping the current values
+// of the keys the file doesn't set.
+func DecodeFile(path string, c *Config) (err error) {
+	f, err := os.Open(path)
 	if err != nil {
 		return
 	}
+	defer f.Close()
 
-	err = yaml.Unmarshal(bytes, &GConfig)
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	err = decoder.Decode(c)
 	if err != nil {
-		return
+		return fmt.Errorf("load config %s: %w", path, err)
 	}
 
 	return
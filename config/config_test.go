@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/test-go/testify/require"
 )
@@ -10,5 +13,262 @@ import (
 func TestLoadFromFile(t *testing.T) {
 	err := LoadFromFile("../config.demo.yaml")
 	require.Nil(t, err, "LoadFromFile err")
-	fmt.Println(GConfig.ToString())
+	fmt.Println(Cfg.ToString())
+
+	require.Equal(t, "TEST", Cfg.Biz.Ins.Tick)
+	require.Equal(t, uint64(888), Cfg.Biz.OpenMintHeight)
+	require.Equal(t, 1, Cfg.BlockWorkers)
+	require.Nil(t, Cfg.Validate())
+}
+
+func TestValidate(t *testing.T) {
+	c := Config{
+		BlockWorkers:    1,
+		ProgressBackend: ProgressMemory,
+		Pg:              Postgres{Host: "127.0.0.1", Port: 5432, User: "postgres", DbName: "ins", BatchSize: 500, BatchInterval: time.Second},
+		Biz:             Business{Ins: Inscription{P: "test-20", Tick: "TEST"}},
+	}
+	require.Nil(t, c.Validate())
+
+	c.BlockWorkers = 0
+	c.Pg.Port = 0
+	c.Biz.Ins.Ops = []Op{{Name: "mint"}, {Name: "mint"}}
+	err := c.Validate()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "workers must be positive")
+	require.Contains(t, err.Error(), "postgres port 0 out of range")
+	require.Contains(t, err.Error(), "op mint defined twice")
+}
+
+func TestValidateLog(t *testing.T) {
+	c := Config{
+		BlockWorkers:    1,
+		ProgressBackend: ProgressMemory,
+		Pg:              Postgres{Host: "127.0.0.1", Port: 5432, User: "postgres", DbName: "ins", BatchSize: 500, BatchInterval: time.Second},
+		Biz:             Business{Ins: Inscription{P: "test-20", Tick: "TEST"}},
+		Log:             Log{Level: "debug", Format: "json", SampleInitial: 100, SampleThereafter: 100},
+	}
+	require.Nil(t, c.Validate())
+
+	c.Log = Log{Level: "verbose", Format: "text", SampleInitial: 10}
+	err := c.Validate()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), `log level must be debug, info, warn or error, got "verbose"`)
+	require.Contains(t, err.Error(), `log format must be json or console, got "text"`)
+	require.Contains(t, err.Error(), "log sampleThereafter must be positive when sampling, got 0")
+}
+
+func TestValidateRPC(t *testing.T) {
+	c := Config{
+		BlockWorkers:    1,
+		ProgressBackend: ProgressMemory,
+		Pg:              Postgres{Host: "127.0.0.1", Port: 5432, User: "postgres", DbName: "ins", BatchSize: 500, BatchInterval: time.Second},
+		Biz:             Business{Ins: Inscription{P: "test-20", Tick: "TEST"}},
+		Sinks:           "postgres, kafka",
+		Kafka:           Kafka{Brokers: "127.0.0.1:9092", Topic: "ops"},
+		RPC:             RPC{Commitment: CommitmentConfirmed},
+	}
+	require.True(t, c.Confirmed())
+	require.Nil(t, c.Validate())
+
+	c.Sinks = "postgres, jsonl"
+	c.JSONL = JSONL{Dir: "ops"}
+	err := c.Validate()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "sink jsonl can't roll back operations")
+
+	// the webhooks are only posted the finalized operations
+	c.Sinks = "postgres"
+	c.Webhooks = []Webhook{{Name: "all", URL: "http://127.0.0.1/hook", Secret: "s", MaxAttempts: 1}}
+	require.Nil(t, c.Validate())
+
+	c.RPC.Commitment = "processed"
+	err = c.Validate()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), `rpc commitment must be finalized or confirmed, got "processed"`)
+	require.NotContains(t, err.Error(), "sink jsonl")
+}
+
+func TestValidateIngestion(t *testing.T) {
+	c := Config{
+		BlockWorkers:    1,
+		ProgressBackend: ProgressMemory,
+		Pg:              Postgres{Host: "127.0.0.1", Port: 5432, User: "postgres", DbName: "ins", BatchSize: 500, BatchInterval: time.Second},
+		Biz:             Business{Ins: Inscription{P: "test-20", Tick: "TEST"}},
+		Ingestion:       IngestGeyser,
+		Geyser:          Geyser{Endpoint: "127.0.0.1:10000"},
+	}
+	require.Nil(t, c.Validate())
+
+	c.Geyser.Endpoint = ""
+	c.RPC.Commitment = CommitmentConfirmed
+	err := c.Validate()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "geyser endpoint is empty")
+	require.Contains(t, err.Error(), "geyser ingestion streams the finalized blocks")
+
+	c.Ingestion = "poll"
+	err = c.Validate()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), `ingestion must be rpc, geyser or signatures, got "poll"`)
+
+	c.Ingestion = IngestSignatures
+	c.Signatures.Treasury = "treasury"
+	err = c.Validate()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), `signatures treasury "treasury" is not an address`)
+	require.Contains(t, err.Error(), "signatures ingestion pages the finalized transactions")
+
+	c.Signatures.Treasury = "11111111111111111111111111111111"
+	c.RPC.Commitment = CommitmentFinalized
+	require.Nil(t, c.Validate())
+}
+
+func TestValidateSinks(t *testing.T) {
+	c := Config{
+		BlockWorkers:    1,
+		ProgressBackend: ProgressMemory,
+		Pg:              Postgres{BatchSize: 500, BatchInterval: time.Second},
+		Biz:             Business{Ins: Inscription{P: "test-20", Tick: "TEST"}},
+		Sinks:           "sqlite, jsonl",
+		SQLite:          SQLite{Path: "ins.db"},
+		JSONL:           JSONL{Dir: "ops"},
+	}
+	require.Equal(t, []string{SinkSQLite, SinkJSONL}, c.SinkKinds())
+	require.False(t, c.UsesPostgres())
+	require.Nil(t, c.Validate())
+
+	c.Sinks = "sqlite,nats,sqlite"
+	c.SQLite.Path = ""
+	err := c.Validate()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), `got "nats"`)
+	require.Contains(t, err.Error(), "sink sqlite given twice")
+	require.Contains(t, err.Error(), "sqlite path is empty")
+
+	c.Sinks = "kafka,sqlite"
+	err = c.Validate()
+	require.Contains(t, err.Error(), "sink kafka can't be the first one")
+	require.Contains(t, err.Error(), "kafka brokers or topic is empty")
+
+	c.Sinks = ""
+	require.Equal(t, []string{SinkPostgres}, c.SinkKinds())
+	require.Contains(t, c.Validate().Error(), "postgres host is empty")
+}
+
+func TestValidateWebhooks(t *testing.T) {
+	c := Config{
+		BlockWorkers:    1,
+		ProgressBackend: ProgressMemory,
+		Pg:              Postgres{Host: "127.0.0.1", Port: 5432, User: "postgres", DbName: "ins", BatchSize: 500, BatchInterval: time.Second},
+		Biz:             Business{Ins: Inscription{P: "test-20", Tick: "TEST"}},
+		Webhooks:        []Webhook{{Name: "whale", URL: "https://example.com/hook", Secret: "s3cret"}},
+	}
+	require.Nil(t, c.Validate())
+	require.NotContains(t, c.ToString(), "s3cret")
+
+	c.Webhooks = append(c.Webhooks, Webhook{Name: "whale", URL: "ftp://example.com"})
+	err := c.Validate()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "webhook whale defined twice")
+	require.Contains(t, err.Error(), `url "ftp://example.com" is not http(s)`)
+	require.Contains(t, err.Error(), "webhook whale has no secret")
+}
+
+func TestPostgresDataSource(t *testing.T) {
+	pg := Postgres{Host: "127.0.0.1", Port: 5432, User: "postgres", Password: "it's secret", DbName: "ins", SSLMode: "verify-full", SSLRootCert: "/etc/ca.pem"}
+
+	ds, err := pg.DataSource()
+	require.Nil(t, err)
+	require.Equal(t, `host='127.0.0.1' port=5432 user='postgres' password='it\'s secret' dbname='ins' sslmode='verify-full' sslrootcert='/etc/ca.pem'`, ds)
+	require.NotContains(t, pg.Redacted(), "secret")
+
+	pg.URL = "postgres://postgres:s3cret@db:5432/ins"
+	ds, err = pg.DataSource()
+	require.Nil(t, err)
+	require.Equal(t, "postgres://postgres:s3cret@db:5432/ins?sslmode=verify-full&sslrootcert=%2Fetc%2Fca.pem", ds)
+	require.NotContains(t, pg.Redacted(), "s3cret")
+
+	pg.URL = "postgres://postgres:s3cret@db:5432/ins?sslmode=require"
+	ds, _ = pg.DataSource()
+	require.Contains(t, ds, "sslmode=require")
+
+	// lib/pq's default applies to a url without sslmode, the fields disable TLS
+	noTLS := Postgres{Host: "db", Port: 5432, User: "postgres", DbName: "ins", URL: "postgres://postgres:s3cret@db:5432/ins"}
+	ds, _ = noTLS.DataSource()
+	require.Equal(t, "postgres://postgres:s3cret@db:5432/ins", ds)
+	noTLS.URL = ""
+	ds, _ = noTLS.DataSource()
+	require.Contains(t, ds, "sslmode='disable'")
+
+	pg.URL = "postgres://postgres:s3cret@db:port/ins"
+	_, err = pg.DataSource()
+	require.NotNil(t, err)
+	require.NotContains(t, err.Error(), "s3cret")
+
+	c := Config{Pg: pg}
+	require.NotContains(t, c.ToString(), "s3cret")
+	require.NotContains(t, c.ToString(), "it's secret")
+}
+
+func TestPasswordFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pg_password")
+	require.Nil(t, os.WriteFile(path, []byte("from-file\n"), 0600))
+
+	pg := Postgres{Password: "from-flag", PasswordFile: path}
+	require.Nil(t, pg.LoadSecrets())
+	require.Equal(t, "from-file", pg.Password.Reveal())
+	require.Equal(t, redacted, pg.Password.String())
+}
+
+func TestRulesSchedule(t *testing.T) {
+	Cfg.Biz = Business{OpenMintHeight: 100, DeployHeight: 50}
+	defer ResetRules()
+
+	require.Equal(t, uint64(100), BizAt(1000).OpenMintHeight)
+
+	r := Cfg.Biz.Rules()
+	r.OpenMintHeight = 200
+	ScheduleRules(500, r)
+	r.OpenMintHeight = 300
+	ScheduleRules(800, r)
+
+	require.Equal(t, uint64(100), BizAt(499).OpenMintHeight)
+	require.Equal(t, uint64(200), BizAt(500).OpenMintHeight)
+	require.Equal(t, uint64(300), BizAt(800).OpenMintHeight)
+	require.Equal(t, uint64(50), BizAt(800).DeployHeight)
+
+	r.OpenMintHeight = 400
+	ScheduleRules(600, r)
+	require.Equal(t, []RulesVersion{{500, Rules{OpenMintHeight: 200}}, {600, Rules{OpenMintHeight: 400}}}, RulesVersions())
+	require.Equal(t, uint64(400), BizAt(900).OpenMintHeight)
+}
+
+func TestRescheduleRules(t *testing.T) {
+	Cfg.Biz = Business{OpenMintHeight: 100}
+	defer ResetRules()
+
+	r := Cfg.Biz.Rules()
+	r.OpenMintHeight = 200
+	require.Equal(t, uint64(500), RescheduleRules(500, r))
+
+	// the operations of slot 700 have been checked under the rules of 500
+	require.Equal(t, uint64(200), BizAt(700).OpenMintHeight)
+	r.OpenMintHeight = 300
+	require.Equal(t, uint64(701), RescheduleRules(600, r))
+	require.Equal(t, uint64(200), BizAt(700).OpenMintHeight)
+	require.Equal(t, uint64(300), BizAt(701).OpenMintHeight)
+	require.Equal(t, uint64(300), LatestRules().OpenMintHeight)
+
+	SetDeployHeight(50)
+	SetDeployHeight(60)
+	require.Equal(t, uint64(50), BizAt(701).DeployHeight)
+}
+
+func TestMergeRules(t *testing.T) {
+	cur := Rules{OpenMintHeight: 10, OpenTransferHeight: 20}
+	prev := Rules{OpenMintHeight: 1, OpenTransferHeight: 2}
+	next := Rules{OpenMintHeight: 1, OpenTransferHeight: 3, MintCapPerAddr: 5}
+
+	require.Equal(t, Rules{OpenMintHeight: 10, OpenTransferHeight: 3, MintCapPerAddr: 5}, MergeRules(cur, prev, next))
 }
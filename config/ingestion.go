@@ -0,0 +1,47 @@
+package config
+
+import "github.com/gagliardetto/solana-go"
+
+const (
+	IngestRPC        = "rpc"        // every block fetched with getBlock
+	IngestGeyser     = "geyser"     // the blocks streamed by a Yellowstone gRPC endpoint
+	IngestSignatures = "signatures" // the memo transactions found with getSignaturesForAddress
+)
+
+// Geyser is a Yellowstone gRPC endpoint streaming the finalized blocks.
+type Geyser struct {
+	Endpoint  string `yaml:"endpoint"` // host:port
+	Token     Secret `yaml:"token"`    // sent in the x-token header
+	TokenFile string `yaml:"tokenFile"`
+	TLS       bool   `yaml:"tls"`
+}
+
+func (g *Geyser) LoadSecrets() (err error) {
+	if g.TokenFile != "" {
+		g.Token, err = readSecretFile(g.TokenFile)
+	}
+	return
+}
+
+// Signatures finds the transactions to fetch with getSignaturesForAddress on
+// the memo program, and on the treasury when set.
+type Signatures struct {
+	Treasury string `yaml:"treasury"` // base58 address
+}
+
+func (c *Config) checkIngestion(p *problems) {
+	switch c.Ingestion {
+	case "", IngestRPC:
+	case IngestGeyser:
+		p.check(c.Geyser.Endpoint != "", "geyser endpoint is empty")
+		p.check(!c.Confirmed(), "geyser ingestion streams the finalized blocks, it doesn't support commitment confirmed")
+	case IngestSignatures:
+		if c.Signatures.Treasury != "" {
+			_, err := solana.PublicKeyFromBase58(c.Signatures.Treasury)
+			p.check(err == nil, "signatures treasury %q is not an address", c.Signatures.Treasury)
+		}
+		p.check(!c.Confirmed(), "signatures ingestion pages the finalized transactions, it doesn't support commitment confirmed")
+	default:
+		p.check(false, "ingestion must be %s, %s or %s, got %q", IngestRPC, IngestGeyser, IngestSignatures, c.Ingestion)
+	}
+}
@@ -1,6 +1,25 @@
 package config
 
 type Inscription struct {
-	P    string
-	Tick string
+	P    string `yaml:"p"`
+	Tick string `yaml:"tick"`
+	Ops  []Op   `yaml:"ops"`
+}
+
+// Op describes an operation accepted for the protocol. Fields lists the memo
+// fields the op must carry, numeric ones as positive integers, Transfer
+// requires the memo to be paired with a SOL system transfer in the same tx.
+type Op struct {
+	Name     string   `yaml:"name"`
+	Fields   []string `yaml:"fields"`
+	Transfer bool     `yaml:"transfer"`
+}
+
+func (o *Op) HasField(field string) bool {
+	for _, f := range o.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"go.uber.org/zap/zapcore"
+
+	"sol_block_extractord/log"
+)
+
+type Log struct {
+	Level            string `yaml:"level"`            // debug, info, warn or error
+	Format           string `yaml:"format"`           // json or console, console when empty
+	SampleInitial    int    `yaml:"sampleInitial"`    // entries with the same message kept every second before sampling, 0 disables it
+	SampleThereafter int    `yaml:"sampleThereafter"` // then one in that many is kept
+}
+
+func (l Log) Options() log.Options {
+	return log.Options{Level: l.Level, Format: l.Format, SampleInitial: l.SampleInitial, SampleThereafter: l.SampleThereafter}
+}
+
+func (l Log) check(p *problems) {
+	_, err := zapcore.ParseLevel(l.Level)
+	p.check(err == nil, "log level must be debug, info, warn or error, got %q", l.Level)
+	p.check(l.Format == "" || l.Format == log.FormatJSON || l.Format == log.FormatConsole,
+		"log format must be %s or %s, got %q", log.FormatJSON, log.FormatConsole, l.Format)
+	p.check(l.SampleInitial >= 0, "log sampleInitial must not be negative, got %d", l.SampleInitial)
+	p.check(l.SampleInitial == 0 || l.SampleThereafter > 0, "log sampleThereafter must be positive when sampling, got %d", l.SampleThereafter)
+}
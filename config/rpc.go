@@ -0,0 +1,33 @@
+package config
+
+const (
+	CommitmentFinalized = "finalized"
+	CommitmentConfirmed = "confirmed"
+)
+
+type RPC struct {
+	URL string `yaml:"url"` // the local validator when empty
+	// Commitment of the blocks indexed, finalized when empty. The operations
+	// of the confirmed ones are provisional until their slot is finalized,
+	// they're rolled back if it's dropped.
+	Commitment string `yaml:"commitment"`
+}
+
+// Confirmed reports whether the blocks are indexed before they're finalized.
+func (c *Config) Confirmed() bool {
+	return c.RPC.Commitment == CommitmentConfirmed
+}
+
+func (c *Config) checkRPC(p *problems) {
+	p.check(c.RPC.Commitment == "" || c.RPC.Commitment == CommitmentFinalized || c.RPC.Commitment == CommitmentConfirmed,
+		"rpc commitment must be %s or %s, got %q", CommitmentFinalized, CommitmentConfirmed, c.RPC.Commitment)
+	if !c.Confirmed() {
+		return
+	}
+
+	// the operations rolled back must be removed from every sink, the
+	// webhooks are only posted the finalized ones
+	for _, kind := range c.SinkKinds() {
+		p.check(kind == SinkPostgres || kind == SinkKafka, "sink %s can't roll back operations, only postgres and kafka support commitment confirmed", kind)
+	}
+}
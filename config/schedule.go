@@ -0,0 +1,121 @@
+package config
+
+import (
+	"math"
+	"reflect"
+	"sync"
+)
+
+// RulesVersion is a set of business rules in force from slot From on.
+type RulesVersion struct {
+	From  uint64
+	Rules Rules
+}
+
+// schedule guards Cfg.Biz too, the pipeline sets its DeployHeight.
+var schedule struct {
+	mu       sync.RWMutex
+	versions []RulesVersion // ascending From
+	read     uint64         // the highest slot BizAt was asked, its rules are in use
+}
+
+// ScheduleRules puts rules in force from slot from on, dropping the versions
+// scheduled at or after it.
+func ScheduleRules(from uint64, rules Rules) {
+	schedule.mu.Lock()
+	defer schedule.mu.Unlock()
+
+	versions := schedule.versions[:0]
+	for _, v := range schedule.versions {
+		if v.From < from {
+			versions = append(versions, v)
+		}
+	}
+	schedule.versions = append(versions, RulesVersion{From: from, Rules: rules})
+}
+
+// RescheduleRules puts rules in force from slot from on like ScheduleRules,
+// or from the slot after the ones whose rules have been read when later, so
+// an operation already checked isn't under other rules on a replay. It
+// returns the slot the rules are in force from.
+func RescheduleRules(from uint64, rules Rules) uint64 {
+	schedule.mu.Lock()
+	defer schedule.mu.Unlock()
+
+	if from <= schedule.read {
+		from = schedule.read + 1
+	}
+	versions := schedule.versions[:0]
+	for _, v := range schedule.versions {
+		if v.From < from {
+			versions = append(versions, v)
+		}
+	}
+	schedule.versions = append(versions, RulesVersion{From: from, Rules: rules})
+	return from
+}
+
+// ResetRules drops the scheduled versions, Cfg.Biz is in force at every slot.
+func ResetRules() {
+	schedule.mu.Lock()
+	defer schedule.mu.Unlock()
+	schedule.versions = nil
+	schedule.read = 0
+}
+
+func RulesVersions() []RulesVersion {
+	schedule.mu.RLock()
+	defer schedule.mu.RUnlock()
+	return append([]RulesVersion(nil), schedule.versions...)
+}
+
+// BizAt is Cfg.Biz with the rules in force at slot, they can't be
+// rescheduled at slot afterwards.
+func BizAt(slot uint64) Business {
+	schedule.mu.Lock()
+	defer schedule.mu.Unlock()
+	if slot > schedule.read {
+		schedule.read = slot
+	}
+	return bizAt(slot)
+}
+
+// LatestRules are the rules of the latest version, or of Cfg.Biz.
+func LatestRules() Rules {
+	schedule.mu.RLock()
+	defer schedule.mu.RUnlock()
+	return bizAt(math.MaxUint64).Rules()
+}
+
+func bizAt(slot uint64) Business {
+	biz := Cfg.Biz
+	for i := len(schedule.versions) - 1; i >= 0; i-- {
+		if schedule.versions[i].From <= slot {
+			biz.SetRules(schedule.versions[i].Rules)
+			break
+		}
+	}
+	return biz
+}
+
+// SetDeployHeight records the height of the deploy op when none is
+// configured.
+func SetDeployHeight(height uint64) {
+	schedule.mu.Lock()
+	defer schedule.mu.Unlock()
+	if Cfg.Biz.DeployHeight == 0 {
+		Cfg.Biz.DeployHeight = height
+	}
+}
+
+// MergeRules applies to cur the rules that changed from prev to next, so
+// values pinned by flags stay unless the file changes them too.
+func MergeRules(cur, prev, next Rules) Rules {
+	c, p, n := reflect.ValueOf(&cur).Elem(), reflect.ValueOf(prev), reflect.ValueOf(next)
+	for i := 0; i < n.NumField(); i++ {
+		if !p.Field(i).Equal(n.Field(i)) {
+			c.Field(i).Set(n.Field(i))
+		}
+	}
+	return cur
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const redacted = "******"
+
+// Secret is a credential that never shows up in printed config or logs, use
+// Reveal to get the actual value.
+type Secret string
+
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// readSecretFile reads a secret mounted as a file, like docker or k8s secrets.
+func readSecretFile(path string) (Secret, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read secret file: %w", err)
+	}
+	return Secret(strings.TrimSpace(string(bytes))), nil
+}
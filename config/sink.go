@@ -0,0 +1,52 @@
+package config
+
+import "strings"
+
+const (
+	SinkPostgres = "postgres"
+	SinkSQLite   = "sqlite"
+	SinkJSONL    = "jsonl"
+	SinkKafka    = "kafka"
+)
+
+type SQLite struct {
+	Path string `yaml:"path"`
+}
+
+type JSONL struct {
+	Dir string `yaml:"dir"` // operations.jsonl and rejections.jsonl are appended in it
+}
+
+// Kafka is where the kafka sink publishes, the messages are keyed by slot and
+// all go to the first partition of Topic to keep their order.
+type Kafka struct {
+	Brokers string `yaml:"brokers"` // comma separated host:port
+	Topic   string `yaml:"topic"`
+}
+
+// SinkKinds are the comma separated Sinks, postgres when none is given.
+func (c *Config) SinkKinds() []string {
+	var kinds []string
+	for _, kind := range strings.Split(c.Sinks, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(kinds) == 0 {
+		return []string{SinkPostgres}
+	}
+	return kinds
+}
+
+// UsesPostgres reports whether a postgres connection is needed.
+func (c *Config) UsesPostgres() bool {
+	if c.ProgressBackend == ProgressPostgres {
+		return true
+	}
+	for _, kind := range c.SinkKinds() {
+		if kind == SinkPostgres {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"net/url"
+	"time"
+)
+
+// Webhook subscribes a URL to the accepted operations, the empty filters
+// match everything.
+type Webhook struct {
+	Name       string `yaml:"name"`
+	URL        string `yaml:"url"`
+	Secret     Secret `yaml:"secret"` // signs the payloads with HMAC-SHA256
+	SecretFile string `yaml:"secretFile"`
+
+	Ticks []string `yaml:"ticks"`
+	Ops   []string `yaml:"ops"`
+	From  []string `yaml:"from"`
+	To    []string `yaml:"to"` // the address receiving the tokens
+
+	MaxAttempts int           `yaml:"maxAttempts"` // before the payload goes to the dead letters, 5 by default
+	Backoff     time.Duration `yaml:"backoff"`     // before the first retry, doubled on every retry, 1s by default
+}
+
+func (w *Webhook) LoadSecrets() (err error) {
+	if w.SecretFile != "" {
+		w.Secret, err = readSecretFile(w.SecretFile)
+	}
+	return
+}
+
+func (w *Webhook) check(p *problems) {
+	p.check(w.Name != "", "webhook %s has no name", w.URL)
+	u, err := url.Parse(w.URL)
+	p.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "webhook %s url %q is not http(s)", w.Name, w.URL)
+	p.check(w.Secret != "", "webhook %s has no secret", w.Name)
+	p.check(w.MaxAttempts >= 0, "webhook %s maxAttempts must not be negative", w.Name)
+	p.check(w.Backoff >= 0, "webhook %s backoff must not be negative", w.Name)
+}
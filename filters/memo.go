@@ -7,22 +7,13 @@ import (
 	"sol_block_extractord/types"
 )
 
-var (
-	validOps        = []string{"deploy", "mint", "transfer"} // todo as parameters
-	invalidOpReason = fmt.Sprintf("only support ops: %v", validOps)
-)
-
 func MemoFilterP(p string) bool {
 	return p == config.Cfg.Biz.Ins.P
 }
 
 func MemoFilterOp(Op string) bool {
-	for _, op := range validOps {
-		if Op == op {
-			return true
-		}
-	}
-	return false
+	_, ok := types.FindOp(Op)
+	return ok
 }
 
 func FilterMemo(memo types.Memo) (pass bool, reason string) {
@@ -33,7 +24,7 @@ func FilterMemo(memo types.Memo) (pass bool, reason string) {
 	}
 
 	if !MemoFilterOp(memo.Op) {
-		return false, invalidOpReason
+		return false, fmt.Sprintf("only support ops: %v", types.OpNames())
 	}
 
 	pass, reason = memo.IsValidOp()
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcutil/base58"
 	"github.com/stretchr/testify/require"
 
 	"sol_block_extractord/config"
@@ -50,3 +51,15 @@ func TestFilterMemo(t *testing.T) {
 		require.Equal(t, tc.pass, pass, fmt.Sprintf("case%d, reason:%s", i, reason))
 	}
 }
+
+func TestFilterMemoBase58(t *testing.T) {
+	config.Cfg.Biz.Ins.P = "test-20"
+	config.Cfg.Biz.Ins.Tick = tick
+
+	for i, tc := range testcases {
+		memo, err := types.ParseMemo(base58.Encode([]byte(base64.StdEncoding.EncodeToString([]byte(tc.input)))))
+		require.Equal(t, true, err == nil, fmt.Sprintf("case%d", i))
+		pass, reason := FilterMemo(memo)
+		require.Equal(t, tc.pass, pass, fmt.Sprintf("case%d, reason:%s", i, reason))
+	}
+}
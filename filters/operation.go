@@ -1,37 +1,78 @@
 package filters
 
 import (
+	"github.com/gagliardetto/solana-go"
+
 	"sol_block_extractord/config"
+	"sol_block_extractord/ledger"
 	"sol_block_extractord/types"
 )
 
 const (
 	ReasonMintNotOpen     = "mint not open"
+	ReasonMintClosed      = "mint closed"
+	ReasonMintCapPerAddr  = "mint cap per address reached"
+	ReasonMintCapPerSlot  = "mint cap per slot reached"
 	ReasonTransferNotOpen = "transfer not open"
+	ReasonBurnNotOpen     = "burn not open"
+	ReasonMarketNotOpen   = "market not open"
 	ReasonAlreadyDeployed = "already deployed"
+	ReasonWrongRecipient  = "wrong recipient in transfer op"
 )
 
-func FilterOperation(op types.Operation) (bool, string) {
+// FilterOperation checks op against the business rules, and against the
+// balances and mint history in state when it isn't nil.
+func FilterOperation(op types.Operation, state *ledger.Ledger) (bool, string) {
 	pass, reason := FilterMemo(op.M)
 	if !pass {
 		return false, reason
 	}
 
+	biz := config.BizAt(op.Slot)
+
 	if op.M.Op == types.OpDeploy {
-		if config.Cfg.Biz.DeployHeight != 0 {
+		if biz.DeployHeight != 0 {
 			return false, ReasonAlreadyDeployed
 		}
 	} else if op.M.Op == types.OpMint {
-		if op.BlockHeight < config.Cfg.Biz.OpenMintHeight {
+		if op.BlockHeight < biz.OpenMintHeight {
 			return false, ReasonMintNotOpen
 		}
+		if biz.CloseMintHeight != 0 && op.BlockHeight >= biz.CloseMintHeight {
+			return false, ReasonMintClosed
+		}
+		if state != nil {
+			if biz.MintCapPerAddr != 0 && state.MintedBy(op.From)+op.M.AmtN > biz.MintCapPerAddr {
+				return false, ReasonMintCapPerAddr
+			}
+			if biz.MintCapPerSlot != 0 && state.MintedAt(op.Slot)+op.M.AmtN > biz.MintCapPerSlot {
+				return false, ReasonMintCapPerSlot
+			}
+		}
 	} else if op.M.Op == types.OpTransfer {
-		if op.BlockHeight < config.Cfg.Biz.OpenTransferHeight {
+		if op.BlockHeight < biz.OpenTransferHeight {
 			return false, ReasonTransferNotOpen
 		}
+		if transfer, _ := types.FindOp(op.M.Op); transfer.HasField(types.ColumnNameTo) {
+			if _, err := solana.PublicKeyFromBase58(op.M.To); err != nil {
+				return false, ReasonWrongRecipient
+			}
+		}
+	} else if op.M.Op == types.OpBurn {
+		if op.BlockHeight < biz.OpenTransferHeight {
+			return false, ReasonBurnNotOpen
+		}
+	} else if op.M.Op == types.OpList || op.M.Op == types.OpBuy || op.M.Op == types.OpCancel {
+		if op.BlockHeight < biz.OpenTransferHeight {
+			return false, ReasonMarketNotOpen
+		}
 	} else {
 		return false, "op not supported"
 	}
 
+	if state != nil {
+		return state.Check(op)
+	}
+
 	return true, ""
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"sol_block_extractord/config"
+	"sol_block_extractord/ledger"
 	"sol_block_extractord/types"
 )
 
@@ -45,7 +46,7 @@ func TestFilterOperation(t *testing.T) {
 	}
 
 	for i, tc := range tcs {
-		pass, reason := FilterOperation(tc.op)
+		pass, reason := FilterOperation(tc.op, nil)
 		if pass != tc.pass {
 			t.Fatalf("case %d failed, reason: %s", i, reason)
 		} else {
@@ -75,12 +76,12 @@ func TestDeploy(t *testing.T) {
 
 	deployOp := types.Operation{BlockHeight: openMintHeight, To: to, Denom: denom, Value: uint256.NewInt(10), M: validMemo}
 
-	pass, reason := FilterOperation(deployOp)
+	pass, reason := FilterOperation(deployOp, nil)
 	t.Log(reason)
 	require.Equal(t, true, pass)
 
 	config.Cfg.Biz.DeployHeight = deployHeight
-	pass, reason = FilterOperation(deployOp)
+	pass, reason = FilterOperation(deployOp, nil)
 	t.Log(reason)
 	require.Equal(t, false, pass)
 }
@@ -108,7 +109,7 @@ func TestMint(t *testing.T) {
 	}
 
 	for i, tc := range tcs {
-		pass, reason := FilterOperation(tc.op)
+		pass, reason := FilterOperation(tc.op, nil)
 		if pass == false {
 			t.Logf("reason:%s", reason)
 		}
@@ -131,18 +132,129 @@ func TestTransfer(t *testing.T) {
 		Tick: tick,
 		Amt:  "100",
 		AmtN: 100,
+		To:   "11111111111111111111111111111111",
 	}
+	noRecipient := transferMemo
+	noRecipient.To = ""
+	wrongRecipient := transferMemo
+	wrongRecipient.To = to
 
 	tcs := [...]TestCaseOp{
 		{false, types.Operation{BlockHeight: openTransferHeight - 1, To: to, Denom: denom, Value: uint256.NewInt(10), M: transferMemo}, "not open"},
 		{true, types.Operation{BlockHeight: openTransferHeight, To: to, Denom: denom, Value: uint256.NewInt(10), M: transferMemo}, "ok"},
+		{false, types.Operation{BlockHeight: openTransferHeight, To: to, Denom: denom, Value: uint256.NewInt(10), M: noRecipient}, "no recipient"},
+		{false, types.Operation{BlockHeight: openTransferHeight, To: to, Denom: denom, Value: uint256.NewInt(10), M: wrongRecipient}, "wrong recipient"},
 	}
 
 	for i, tc := range tcs {
-		pass, reason := FilterOperation(tc.op)
+		pass, reason := FilterOperation(tc.op, nil)
 		if pass == false {
 			t.Logf("reason:%s", reason)
 		}
 		require.Equal(t, tc.pass, pass, fmt.Sprintf("case %d failed desc: %s, reason: %s", i, tc.desc, reason))
+		if i >= 2 {
+			require.Equal(t, ReasonWrongRecipient, reason)
+		}
+	}
+
+	// an op set not declaring the to field doesn't require a recipient
+	config.Cfg.Biz.Ins.Ops = []config.Op{{Name: types.OpTransfer, Fields: []string{types.ColumnNameAmt}}}
+	defer func() { config.Cfg.Biz.Ins.Ops = nil }()
+	pass, reason := FilterOperation(types.Operation{BlockHeight: openTransferHeight, To: to, Denom: denom, Value: uint256.NewInt(10), M: noRecipient}, nil)
+	require.True(t, pass, reason)
+}
+
+func TestBurn(t *testing.T) {
+	config.Cfg.Biz = config.Business{
+		Ins:                config.Inscription{P: inscriptionP, Tick: tick},
+		MemoLenMin:         10,
+		DeployHeight:       0,
+		OpenMintHeight:     openMintHeight,
+		OpenTransferHeight: openTransferHeight,
+	}
+
+	mintMemo := types.Memo{P: inscriptionP, Op: "mint", Tick: tick, Amt: "100", AmtN: 100}
+	burnMemo := types.Memo{P: inscriptionP, Op: "burn", Tick: tick, Amt: "60", AmtN: 60}
+
+	state := ledger.New()
+	state.Apply(types.Operation{BlockHeight: openMintHeight, From: to, Value: uint256.NewInt(0), M: mintMemo})
+
+	tcs := [...]TestCaseOp{
+		{false, types.Operation{BlockHeight: openTransferHeight - 1, From: to, Value: uint256.NewInt(0), M: burnMemo}, "not open"},
+		{true, types.Operation{BlockHeight: openTransferHeight, From: to, Value: uint256.NewInt(0), M: burnMemo}, "ok"},
+		{false, types.Operation{BlockHeight: openTransferHeight, From: "other", Value: uint256.NewInt(0), M: burnMemo}, "no balance"},
+	}
+
+	for i, tc := range tcs {
+		pass, reason := FilterOperation(tc.op, state)
+		require.Equal(t, tc.pass, pass, fmt.Sprintf("case %d failed desc: %s, reason: %s", i, tc.desc, reason))
 	}
 }
+
+func TestMintRules(t *testing.T) {
+	config.Cfg.Biz = config.Business{
+		Ins:                config.Inscription{P: inscriptionP, Tick: tick},
+		MemoLenMin:         10,
+		DeployHeight:       0,
+		OpenMintHeight:     openMintHeight,
+		OpenTransferHeight: openTransferHeight,
+		CloseMintHeight:    openMintHeight + 100,
+		MintCapPerAddr:     300,
+		MintCapPerSlot:     200,
+	}
+
+	mintMemo := types.Memo{P: inscriptionP, Op: "mint", Tick: tick, Amt: "100", AmtN: 100}
+	mint := func(height uint64, from string) types.Operation {
+		return types.Operation{Slot: height, BlockHeight: height, From: from, Value: uint256.NewInt(0), M: mintMemo}
+	}
+
+	state := ledger.New()
+	state.Apply(mint(openMintHeight, "a"))
+	state.Apply(mint(openMintHeight+1, "a"))
+	state.Apply(mint(openMintHeight+1, "b"))
+
+	tcs := []struct {
+		op     types.Operation
+		reason string
+	}{
+		{mint(openMintHeight+100, "c"), ReasonMintClosed},
+		{mint(openMintHeight+1, "c"), ReasonMintCapPerSlot},
+		{mint(openMintHeight+2, "c"), ""},
+		{mint(openMintHeight+2, "a"), ""},
+	}
+
+	for i, tc := range tcs {
+		pass, reason := FilterOperation(tc.op, state)
+		require.Equal(t, tc.reason == "", pass, fmt.Sprintf("case %d", i))
+		require.Equal(t, tc.reason, reason, fmt.Sprintf("case %d", i))
+	}
+
+	state.Apply(mint(openMintHeight+2, "a"))
+	pass, reason := FilterOperation(mint(openMintHeight+3, "a"), state)
+	require.False(t, pass)
+	require.Equal(t, ReasonMintCapPerAddr, reason)
+}
+
+// TestScheduledRules checks a reload takes effect from its slot, whatever the
+// block height.
+func TestScheduledRules(t *testing.T) {
+	config.Cfg.Biz = config.Business{
+		Ins:                config.Inscription{P: inscriptionP, Tick: tick},
+		OpenMintHeight:     openMintHeight,
+		OpenTransferHeight: openTransferHeight,
+	}
+	r := config.Cfg.Biz.Rules()
+	r.CloseMintHeight = openMintHeight + 1
+	config.ScheduleRules(1000, r)
+	defer config.ResetRules()
+
+	mint := types.Operation{Slot: 999, BlockHeight: openMintHeight + 10, Value: uint256.NewInt(0),
+		M: types.Memo{P: inscriptionP, Op: "mint", Tick: tick, Amt: "100", AmtN: 100}}
+	pass, reason := FilterOperation(mint, nil)
+	require.True(t, pass, reason)
+
+	mint.Slot = 1000
+	pass, reason = FilterOperation(mint, nil)
+	require.False(t, pass)
+	require.Equal(t, ReasonMintClosed, reason)
+}
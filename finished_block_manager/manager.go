@@ -1,23 +1,72 @@
 package finished_block_manager
 
 import (
-	"sync/atomic"
+	"sync"
 )
 
-var finishedHeight uint64
+// ProgressTracker tracks the last slot whose operations have all been
+// committed. The finished slot only moves forward.
+type ProgressTracker interface {
+	Get() uint64
+	Update(height uint64)
+	// Wait returns a channel closed once the finished slot reaches height.
+	Wait(height uint64) <-chan struct{}
+}
+
+type waiter struct {
+	height uint64
+	ch     chan struct{}
+}
 
-func Setup(startBlock uint64) {
-	finishedHeight = 0
+type MemoryTracker struct {
+	mu             sync.Mutex
+	finishedHeight uint64
+	waiters        []waiter
+}
+
+func NewMemoryTracker(startBlock uint64) *MemoryTracker {
+	t := &MemoryTracker{}
 	if startBlock > 0 {
-		Update(startBlock - 1)
+		t.finishedHeight = startBlock - 1
 	}
+	return t
 }
 
-func Get() uint64 {
-	return atomic.LoadUint64(&finishedHeight)
+func (t *MemoryTracker) Get() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.finishedHeight
 }
 
-func Update(height uint64) {
-	old := atomic.LoadUint64(&finishedHeight)
-	atomic.CompareAndSwapUint64(&finishedHeight, old, height)
+func (t *MemoryTracker) Update(height uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if height <= t.finishedHeight {
+		return
+	}
+	t.finishedHeight = height
+
+	waiters := t.waiters[:0]
+	for _, w := range t.waiters {
+		if w.height <= height {
+			close(w.ch)
+		} else {
+			waiters = append(waiters, w)
+		}
+	}
+	t.waiters = waiters
+}
+
+func (t *MemoryTracker) Wait(height uint64) <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ch := make(chan struct{})
+	if height <= t.finishedHeight {
+		close(ch)
+		return ch
+	}
+	t.waiters = append(t.waiters, waiter{height: height, ch: ch})
+	return ch
 }
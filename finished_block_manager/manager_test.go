@@ -0,0 +1,66 @@
+package finished_block_manager
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryTrackerMonotonic(t *testing.T) {
+	tracker := NewMemoryTracker(10)
+	require.Equal(t, uint64(9), tracker.Get())
+
+	tracker.Update(12)
+	tracker.Update(11)
+	require.Equal(t, uint64(12), tracker.Get())
+
+	require.Equal(t, uint64(0), NewMemoryTracker(0).Get())
+}
+
+func TestMemoryTrackerConcurrentUpdate(t *testing.T) {
+	tracker := NewMemoryTracker(0)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 1000; i++ {
+		wg.Add(1)
+		go func(height uint64) {
+			defer wg.Done()
+			tracker.Update(height)
+		}(uint64(i))
+	}
+	wg.Wait()
+
+	require.Equal(t, uint64(1000), tracker.Get())
+}
+
+func TestMemoryTrackerWait(t *testing.T) {
+	tracker := NewMemoryTracker(5)
+
+	select {
+	case <-tracker.Wait(4):
+	default:
+		t.Fatal("wait on a finished height should not block")
+	}
+
+	ch6, ch8 := tracker.Wait(6), tracker.Wait(8)
+	tracker.Update(6)
+	select {
+	case <-ch6:
+	case <-time.After(time.Second):
+		t.Fatal("wait 6 not notified")
+	}
+	select {
+	case <-ch8:
+		t.Fatal("wait 8 notified early")
+	default:
+	}
+
+	tracker.Update(9)
+	select {
+	case <-ch8:
+	case <-time.After(time.Second):
+		t.Fatal("wait 8 not notified")
+	}
+}
@@ -0,0 +1,110 @@
+package fixture
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const ext = ".json"
+
+// skipped is the result of getBlock at a slot without a block.
+var skipped = []byte("null")
+
+// Path is the file of slot's block in dir.
+func Path(dir string, slot uint64) string {
+	return filepath.Join(dir, strconv.FormatUint(slot, 10)+ext)
+}
+
+// Save writes the getBlock result of slot as the RPC returned it, nil for a
+// skipped slot.
+func Save(dir string, slot uint64, result json.RawMessage) error {
+	if len(result) == 0 {
+		result = skipped
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	// write aside and rename, a capture stopped midway leaves no broken block
+	tmp := Path(dir, slot) + ".tmp"
+	if err := os.WriteFile(tmp, result, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, Path(dir, slot))
+}
+
+// Load reads the block of slot saved in dir, nil when the slot was skipped.
+// It returns an error wrapping os.ErrNotExist when the slot wasn't captured.
+func Load(dir string, slot uint64) (*rpc.GetBlockResult, error) {
+	data, err := os.ReadFile(Path(dir, slot))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(bytes.TrimSpace(data), skipped) {
+		return nil, nil
+	}
+	var b rpc.GetBlockResult
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("block %d: %w", slot, err)
+	}
+	return &b, nil
+}
+
+// Slots are the slots saved in dir in order.
+func Slots(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var slots []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		slot, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+		if err != nil {
+			continue
+		}
+		slots = append(slots, slot)
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i] < slots[j] })
+	return slots, nil
+}
+
+// ParseSlots reads a comma separated list of slots and inclusive ranges, like
+// 100,105-110.
+func ParseSlots(s string) ([]uint64, error) {
+	var slots []uint64
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := strconv.ParseUint(first, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slot %q", part)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.ParseUint(last, 10, 64); err != nil || to < from {
+				return nil, fmt.Errorf("invalid slot range %q", part)
+			}
+		}
+		for slot := from; slot <= to; slot++ {
+			slots = append(slots, slot)
+		}
+	}
+	if len(slots) == 0 {
+		return nil, fmt.Errorf("no slots in %q", s)
+	}
+	return slots, nil
+}
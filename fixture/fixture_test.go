@@ -0,0 +1,47 @@
+package fixture
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const block = `{"blockHeight":90,"blockTime":1700000000,"blockhash":"EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG","parentSlot":99,"previousBlockhash":"11111111111111111111111111111111","transactions":[]}`
+
+func TestSaveLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "blocks")
+	require.NoError(t, Save(dir, 100, json.RawMessage(block)))
+	require.NoError(t, Save(dir, 101, nil))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), nil, 0o644))
+
+	slots, err := Slots(dir)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{100, 101}, slots)
+
+	b, err := Load(dir, 100)
+	require.NoError(t, err)
+	require.Equal(t, uint64(90), *b.BlockHeight)
+	require.Equal(t, uint64(99), b.ParentSlot)
+	require.Equal(t, "EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG", b.Blockhash.String())
+
+	b, err = Load(dir, 101)
+	require.NoError(t, err)
+	require.Nil(t, b)
+
+	_, err = Load(dir, 102)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestParseSlots(t *testing.T) {
+	slots, err := ParseSlots("100, 105-107,110")
+	require.NoError(t, err)
+	require.Equal(t, []uint64{100, 105, 106, 107, 110}, slots)
+
+	for _, s := range []string{"", "a", "107-105", "100-"} {
+		_, err := ParseSlots(s)
+		require.Error(t, err, s)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/status"
+
+	"sol_block_extractord/finished_block_manager"
+	"sol_block_extractord/geyser"
+	"sol_block_extractord/log"
+	"sol_block_extractord/metrics"
+	"sol_block_extractord/source"
+)
+
+// SOLStreamBlocks hands blockCh the finalized blocks streamed by client from
+// startHeight on in slot order, and closes it once ctx is done. The slots the
+// stream misses, before its first block or across a reconnection, are fetched
+// from src with workers concurrent fetches.
+func SOLStreamBlocks(ctx context.Context, client *geyser.Client, src source.BlockSource, startHeight uint64, workers int, tracker finished_block_manager.ProgressTracker, blockCh chan SlotBlock) {
+	defer close(blockCh)
+
+	next := startHeight // the next slot to hand over
+	for {
+		err := streamBlocks(ctx, client, src, workers, tracker, blockCh, &next)
+		if ctx.Err() != nil {
+			log.Logger.Info("stream stopped", zap.Uint64("slot", next))
+			return
+		}
+		metrics.RPCErrors.WithLabelValues("subscribe", status.Code(err).String()).Inc()
+		log.Logger.Warn("geyser stream failed, subscribe again", zap.Uint64("slot", next), zap.Error(err))
+		sleep(ctx, time.Second*3)
+	}
+}
+
+// streamBlocks subscribes to the blocks with the memo transactions and hands
+// them over from *next on, until the stream fails or ctx is done.
+func streamBlocks(ctx context.Context, client *geyser.Client, src source.BlockSource, workers int, tracker finished_block_manager.ProgressTracker, blockCh chan SlotBlock, next *uint64) error {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Subscribe(streamCtx, geyser.BlocksRequest(memoProgramId.String(), geyser.CommitmentFinalized))
+	if err != nil {
+		return err
+	}
+	log.Logger.Info("geyser stream subscribed", zap.Uint64("slot", *next))
+
+	for {
+		u, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		blk := u.Block
+		if blk == nil || blk.Slot < *next {
+			continue
+		}
+		metrics.SetHead(blk.Slot)
+
+		// the finalized blocks chain up, a parent past the last block handed
+		// over means the stream missed the slots between. The stream isn't read
+		// meanwhile, after a long catch up the endpoint may drop it.
+		if blk.ParentSlot >= *next {
+			log.Logger.Info("fetch the slots the stream missed", zap.Uint64("from", *next), zap.Uint64("to", blk.ParentSlot))
+			fetchRange(ctx, src, *next, blk.ParentSlot, workers, tracker, blockCh)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+		}
+
+		b := SlotBlock{Slot: blk.Slot}
+		b.GetBlockResult, b.TxIndexes, err = blk.Result()
+		if err != nil {
+			log.Logger.Warn("streamed block not decoded, fetch it", zap.Uint64("slot", blk.Slot), zap.Error(err))
+			fetchRange(ctx, src, blk.Slot, blk.Slot, 1, tracker, blockCh)
+		} else {
+			select {
+			case blockCh <- b:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Logger.Debug("streamed block handed over", zap.Uint64("slot", blk.Slot), zap.Int("txs", len(blk.Transactions)))
+		*next = blk.Slot + 1
+	}
+}
@@ -0,0 +1,243 @@
+package geyser
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	ServiceName     = "geyser.Geyser"
+	SubscribeMethod = "/" + ServiceName + "/Subscribe"
+
+	maxMessageSize = 64 << 20 // a block with its transactions
+)
+
+type message interface {
+	Marshal() []byte
+	Unmarshal(b []byte) error
+}
+
+// Codec encodes the messages of this package in the protobuf wire format.
+type Codec struct{}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("geyser: can't marshal %T", v)
+	}
+	return m.Marshal(), nil
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("geyser: can't unmarshal %T", v)
+	}
+	return m.Unmarshal(data)
+}
+
+func (Codec) Name() string {
+	return "proto"
+}
+
+// Client subscribes to a Yellowstone gRPC endpoint.
+type Client struct {
+	conn  *grpc.ClientConn
+	token string
+}
+
+// Dial connects to the endpoint lazily, token is sent in the x-token header
+// unless it's empty.
+func Dial(endpoint, token string, useTLS bool) (*Client, error) {
+	creds := insecure.NewCredentials()
+	if useTLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	conn, err := grpc.Dial(endpoint,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec{}), grpc.MaxCallRecvMsgSize(maxMessageSize)),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: 30 * time.Second, Timeout: 10 * time.Second, PermitWithoutStream: true}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("dial geyser %s: %w", endpoint, err)
+	}
+	return &Client{conn: conn, token: token}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Subscribe opens a stream of the updates req filters, until ctx is done.
+func (c *Client) Subscribe(ctx context.Context, req *SubscribeRequest) (*Stream, error) {
+	if c.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-token", c.token)
+	}
+	s, err := c.conn.NewStream(ctx, &grpc.StreamDesc{StreamName: "Subscribe", ServerStreams: true, ClientStreams: true}, SubscribeMethod)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SendMsg(req); err != nil {
+		return nil, err
+	}
+	return &Stream{s: s, req: req}, nil
+}
+
+type Stream struct {
+	s   grpc.ClientStream
+	req *SubscribeRequest
+}
+
+// Recv is the next update, it answers the pings of the endpoint meanwhile.
+func (s *Stream) Recv() (*SubscribeUpdate, error) {
+	for {
+		u := &SubscribeUpdate{}
+		if err := s.s.RecvMsg(u); err != nil {
+			return nil, err
+		}
+		if !u.Ping {
+			return u, nil
+		}
+		// a request replaces the filters, the ping carries them over
+		ping := *s.req
+		ping.Ping = &Ping{ID: 1}
+		if err := s.s.SendMsg(&ping); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// BlocksRequest subscribes to the blocks at commitment, with the
+// transactions using account only. Every block is streamed, the ones without
+// such transactions included.
+func BlocksRequest(account string, commitment CommitmentLevel) *SubscribeRequest {
+	include, exclude := true, false
+	return &SubscribeRequest{
+		Blocks: map[string]BlocksFilter{
+			"blocks": {AccountInclude: []string{account}, IncludeTransactions: &include, IncludeAccounts: &exclude, IncludeEntries: &exclude},
+		},
+		Commitment: &commitment,
+	}
+}
+
+// Result is blk as getBlock returns it with the base64 encoding, along with
+// the index in the block of each of its transactions, since the filter
+// leaves some out.
+func (blk *Block) Result() (*rpc.GetBlockResult, []int, error) {
+	hash, err := solana.HashFromBase58(blk.Blockhash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("block %d hash: %w", blk.Slot, err)
+	}
+	parent, err := solana.HashFromBase58(blk.ParentBlockhash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("block %d parent hash: %w", blk.Slot, err)
+	}
+	r := &rpc.GetBlockResult{Blockhash: hash, PreviousBlockhash: parent, ParentSlot: blk.ParentSlot, BlockHeight: blk.BlockHeight}
+	if blk.BlockTime != nil {
+		at := solana.UnixTimeSeconds(*blk.BlockTime)
+		r.BlockTime = &at
+	}
+
+	indexes := make([]int, 0, len(blk.Transactions))
+	for i := range blk.Transactions {
+		info := &blk.Transactions[i]
+		if info.Transaction == nil {
+			return nil, nil, fmt.Errorf("block %d transaction %d is empty", blk.Slot, info.Index)
+		}
+		tx, err := info.Transaction.solana()
+		if err != nil {
+			return nil, nil, fmt.Errorf("block %d transaction %d: %w", blk.Slot, info.Index, err)
+		}
+		data, err := tx.MarshalBinary()
+		if err != nil {
+			return nil, nil, fmt.Errorf("block %d transaction %d: %w", blk.Slot, info.Index, err)
+		}
+		meta := &rpc.TransactionMeta{}
+		if info.Meta != nil {
+			if info.Meta.Err != nil {
+				meta.Err = fmt.Sprintf("%x", info.Meta.Err) // bincode, only whether it failed matters
+			}
+			// the keys of a v0 transaction go on with the ones its lookup tables loaded
+			if meta.LoadedAddresses.Writable, err = publicKeys(info.Meta.LoadedWritableAddresses); err == nil {
+				meta.LoadedAddresses.ReadOnly, err = publicKeys(info.Meta.LoadedReadonlyAddresses)
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("block %d transaction %d loaded %w", blk.Slot, info.Index, err)
+			}
+		}
+		r.Transactions = append(r.Transactions, rpc.TransactionWithMeta{Slot: blk.Slot, BlockTime: r.BlockTime, Transaction: rpc.DataBytesOrJSONFromBytes(data), Meta: meta})
+		indexes = append(indexes, int(info.Index))
+	}
+	return r, indexes, nil
+}
+
+func publicKeys(keys [][]byte) (out solana.PublicKeySlice, err error) {
+	for _, key := range keys {
+		if len(key) != solana.PublicKeyLength {
+			return nil, fmt.Errorf("account key of %d bytes", len(key))
+		}
+		out = append(out, solana.PublicKeyFromBytes(key))
+	}
+	return
+}
+
+// solana is tx decoded, the keys and signatures checked.
+func (tx *Transaction) solana() (*solana.Transaction, error) {
+	m := tx.Message
+	if m == nil || m.Header == nil {
+		return nil, fmt.Errorf("no message")
+	}
+	out := &solana.Transaction{}
+	for _, sig := range tx.Signatures {
+		if len(sig) != solana.SignatureLength {
+			return nil, fmt.Errorf("signature of %d bytes", len(sig))
+		}
+		out.Signatures = append(out.Signatures, solana.SignatureFromBytes(sig))
+	}
+
+	out.Message.Header = solana.MessageHeader{
+		NumRequiredSignatures:       uint8(m.Header.NumRequiredSignatures),
+		NumReadonlySignedAccounts:   uint8(m.Header.NumReadonlySignedAccounts),
+		NumReadonlyUnsignedAccounts: uint8(m.Header.NumReadonlyUnsignedAccounts),
+	}
+	keys, err := publicKeys(m.AccountKeys)
+	if err != nil {
+		return nil, err
+	}
+	out.Message.AccountKeys = keys
+	if len(m.RecentBlockhash) != 32 {
+		return nil, fmt.Errorf("recent blockhash of %d bytes", len(m.RecentBlockhash))
+	}
+	out.Message.RecentBlockhash = solana.HashFromBytes(m.RecentBlockhash)
+	for _, inst := range m.Instructions {
+		accounts := make([]uint16, len(inst.Accounts))
+		for i, account := range inst.Accounts {
+			accounts[i] = uint16(account)
+		}
+		out.Message.Instructions = append(out.Message.Instructions, solana.CompiledInstruction{ProgramIDIndex: uint16(inst.ProgramIDIndex), Accounts: accounts, Data: inst.Data})
+	}
+	if m.Versioned {
+		out.Message.SetVersion(solana.MessageVersionV0)
+		for _, lookup := range m.AddressTableLookups {
+			if len(lookup.AccountKey) != solana.PublicKeyLength {
+				return nil, fmt.Errorf("lookup table key of %d bytes", len(lookup.AccountKey))
+			}
+			out.Message.AddAddressTableLookup(solana.MessageAddressTableLookup{
+				AccountKey:      solana.PublicKeyFromBytes(lookup.AccountKey),
+				WritableIndexes: lookup.WritableIndexes,
+				ReadonlyIndexes: lookup.ReadonlyIndexes,
+			})
+		}
+	}
+	return out, nil
+}
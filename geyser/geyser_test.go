@@ -0,0 +1,114 @@
+package geyser_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+
+	"sol_block_extractord/geyser"
+	"sol_block_extractord/geyser/geysertest"
+)
+
+const memoProgram = "MemoSq4gqABAXKb96qnH8TysNcWxMyWCqXgDLGmfcHr"
+
+func memoTx(memo string, versioned bool) *geyser.Transaction {
+	sender := solana.NewWallet().PublicKey()
+	m := &geyser.Message{
+		Header:          &geyser.MessageHeader{NumRequiredSignatures: 1, NumReadonlyUnsignedAccounts: 1},
+		AccountKeys:     [][]byte{sender.Bytes(), solana.MustPublicKeyFromBase58(memoProgram).Bytes()},
+		RecentBlockhash: make([]byte, 32),
+		Instructions:    []geyser.CompiledInstruction{{ProgramIDIndex: 1, Accounts: []byte{0}, Data: []byte(memo)}},
+		Versioned:       versioned,
+	}
+	if versioned {
+		m.AddressTableLookups = []geyser.AddressTableLookup{{AccountKey: solana.NewWallet().PublicKey().Bytes(), WritableIndexes: []byte{1}, ReadonlyIndexes: []byte{}}}
+	}
+	sig := make([]byte, 64)
+	sig[0] = byte(len(memo))
+	return &geyser.Transaction{Signatures: [][]byte{sig}, Message: m}
+}
+
+func TestSubscribe(t *testing.T) {
+	server, err := geysertest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	client, err := geyser.Dial(server.Addr, "Token", false)
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.Subscribe(ctx, geyser.BlocksRequest(memoProgram, geyser.CommitmentFinalized))
+	require.NoError(t, err)
+
+	height, at := uint64(90), int64(1700000000)
+	legacy, versioned := memoTx(`{"p":"test-20"}`, false), memoTx(`{"p":"test-20","op":"mint"}`, true)
+	loaded := solana.NewWallet().PublicKey()
+	block := &geyser.Block{
+		Slot: 100, Blockhash: "EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG", BlockTime: &at, BlockHeight: &height,
+		ParentSlot: 98, ParentBlockhash: "11111111111111111111111111111111",
+		Transactions: []geyser.TransactionInfo{
+			{Index: 3, Signature: legacy.Signatures[0], Transaction: legacy, Meta: &geyser.Meta{}},
+			{Index: 7, Signature: versioned.Signatures[0], Transaction: versioned, Meta: &geyser.Meta{Err: []byte{}, LoadedWritableAddresses: [][]byte{loaded.Bytes()}}},
+		},
+	}
+	server.Send(&geyser.SubscribeUpdate{Ping: true})
+	server.Send(&geyser.SubscribeUpdate{Filters: []string{"blocks"}, Block: block})
+
+	u, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, []string{"blocks"}, u.Filters)
+	require.Equal(t, block, u.Block)
+
+	// the ping was answered with the filters
+	require.Eventually(t, func() bool { return len(server.Requests()) == 2 }, time.Second, 10*time.Millisecond)
+	requests := server.Requests()
+	require.Nil(t, requests[0].Ping)
+	require.Equal(t, geyser.CommitmentFinalized, *requests[0].Commitment)
+	filter := requests[0].Blocks["blocks"]
+	require.Equal(t, []string{memoProgram}, filter.AccountInclude)
+	require.True(t, *filter.IncludeTransactions)
+	require.False(t, *filter.IncludeAccounts)
+	require.Equal(t, int32(1), requests[1].Ping.ID)
+	require.Equal(t, requests[0].Blocks, requests[1].Blocks)
+	require.Equal(t, []string{"Token"}, server.Tokens())
+
+	r, indexes, err := u.Block.Result()
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 7}, indexes)
+	require.Equal(t, uint64(98), r.ParentSlot)
+	require.Equal(t, height, *r.BlockHeight)
+	require.Equal(t, solana.UnixTimeSeconds(at), *r.BlockTime)
+	require.Equal(t, "EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG", r.Blockhash.String())
+	require.Len(t, r.Transactions, 2)
+
+	tx, err := r.Transactions[0].GetTransaction()
+	require.NoError(t, err)
+	require.Nil(t, r.Transactions[0].Meta.Err)
+	require.Equal(t, solana.SignatureFromBytes(legacy.Signatures[0]), tx.Signatures[0])
+	require.Equal(t, memoProgram, tx.Message.AccountKeys[tx.Message.Instructions[0].ProgramIDIndex].String())
+	require.Equal(t, `{"p":"test-20"}`, string(tx.Message.Instructions[0].Data))
+
+	tx, err = r.Transactions[1].GetTransaction()
+	require.NoError(t, err)
+	require.NotNil(t, r.Transactions[1].Meta.Err)
+	require.True(t, tx.Message.IsVersioned())
+	require.Len(t, tx.Message.AddressTableLookups, 1)
+	require.Equal(t, []uint16{0}, tx.Message.Instructions[0].Accounts)
+	require.Equal(t, solana.PublicKeySlice{loaded}, r.Transactions[1].Meta.LoadedAddresses.Writable)
+	require.Empty(t, r.Transactions[1].Meta.LoadedAddresses.ReadOnly)
+}
+
+func TestResultInvalid(t *testing.T) {
+	tx := memoTx("memo", false)
+	tx.Message.AccountKeys[0] = []byte{1, 2}
+	_, _, err := (&geyser.Block{
+		Slot: 100, Blockhash: "EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG", ParentBlockhash: "11111111111111111111111111111111",
+		Transactions: []geyser.TransactionInfo{{Index: 1, Transaction: tx}},
+	}).Result()
+	require.ErrorContains(t, err, "account key of 2 bytes")
+}
@@ -0,0 +1,100 @@
+// Package geysertest serves a local Yellowstone gRPC endpoint for the tests.
+package geysertest
+
+import (
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"sol_block_extractord/geyser"
+)
+
+// Server streams the updates sent to it to its subscriber, and keeps the
+// requests it receives.
+type Server struct {
+	Addr string
+
+	srv     *grpc.Server
+	updates chan *geyser.SubscribeUpdate
+
+	mu       sync.Mutex
+	requests []*geyser.SubscribeRequest
+	tokens   []string
+}
+
+// NewServer serves on a free local port until Close.
+func NewServer() (*Server, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Addr:    lis.Addr().String(),
+		srv:     grpc.NewServer(grpc.ForceServerCodec(geyser.Codec{})),
+		updates: make(chan *geyser.SubscribeUpdate, 100),
+	}
+	s.srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: geyser.ServiceName,
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{
+			{StreamName: "Subscribe", Handler: s.subscribe, ServerStreams: true, ClientStreams: true},
+		},
+	}, s)
+	go s.srv.Serve(lis)
+	return s, nil
+}
+
+// Send queues u for the subscriber.
+func (s *Server) Send(u *geyser.SubscribeUpdate) {
+	s.updates <- u
+}
+
+// Requests are the requests received, the ping answers included.
+func (s *Server) Requests() []*geyser.SubscribeRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*geyser.SubscribeRequest(nil), s.requests...)
+}
+
+// Tokens are the x-token headers of the subscriptions.
+func (s *Server) Tokens() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.tokens...)
+}
+
+func (s *Server) Close() {
+	s.srv.Stop()
+}
+
+func (s *Server) subscribe(_ interface{}, stream grpc.ServerStream) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	s.mu.Lock()
+	s.tokens = append(s.tokens, md.Get("x-token")...)
+	s.mu.Unlock()
+
+	go func() {
+		for {
+			req := &geyser.SubscribeRequest{}
+			if err := stream.RecvMsg(req); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.requests = append(s.requests, req)
+			s.mu.Unlock()
+		}
+	}()
+
+	for {
+		select {
+		case u := <-s.updates:
+			if err := stream.SendMsg(u); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,594 @@
+package geyser
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages of the Yellowstone geyser.proto and solana-storage.proto this
+// indexer uses, their other fields are skipped when decoding.
+
+type CommitmentLevel int32
+
+const (
+	CommitmentProcessed CommitmentLevel = 0
+	CommitmentConfirmed CommitmentLevel = 1
+	CommitmentFinalized CommitmentLevel = 2
+)
+
+type SubscribeRequest struct {
+	Blocks     map[string]BlocksFilter // 4
+	Commitment *CommitmentLevel        // 6
+	Ping       *Ping                   // 9
+}
+
+// BlocksFilter streams the blocks with the transactions using any of the
+// AccountInclude accounts, all of them when empty.
+type BlocksFilter struct {
+	AccountInclude      []string // 1
+	IncludeTransactions *bool    // 2
+	IncludeAccounts     *bool    // 3
+	IncludeEntries      *bool    // 4
+}
+
+type Ping struct {
+	ID int32 // 1
+}
+
+type SubscribeUpdate struct {
+	Filters []string // 1
+	Block   *Block   // 5
+	Ping    bool     // 6, the client answers with a ping to keep the stream alive
+}
+
+type Block struct {
+	Slot            uint64            // 1
+	Blockhash       string            // 2
+	BlockTime       *int64            // 4 UnixTimestamp.timestamp
+	BlockHeight     *uint64           // 5 BlockHeight.block_height
+	Transactions    []TransactionInfo // 6
+	ParentSlot      uint64            // 7
+	ParentBlockhash string            // 8
+}
+
+type TransactionInfo struct {
+	Signature   []byte       // 1
+	IsVote      bool         // 2
+	Transaction *Transaction // 3
+	Meta        *Meta        // 4
+	Index       uint64       // 5, in the block
+}
+
+type Transaction struct {
+	Signatures [][]byte // 1
+	Message    *Message // 2
+}
+
+type Message struct {
+	Header              *MessageHeader        // 1
+	AccountKeys         [][]byte              // 2
+	RecentBlockhash     []byte                // 3
+	Instructions        []CompiledInstruction // 4
+	Versioned           bool                  // 5
+	AddressTableLookups []AddressTableLookup  // 6
+}
+
+type MessageHeader struct {
+	NumRequiredSignatures       uint32 // 1
+	NumReadonlySignedAccounts   uint32 // 2
+	NumReadonlyUnsignedAccounts uint32 // 3
+}
+
+type CompiledInstruction struct {
+	ProgramIDIndex uint32 // 1
+	Accounts       []byte // 2
+	Data           []byte // 3
+}
+
+type AddressTableLookup struct {
+	AccountKey      []byte // 1
+	WritableIndexes []byte // 2
+	ReadonlyIndexes []byte // 3
+}
+
+type Meta struct {
+	Err                     []byte   // 1 TransactionError.err, nil when the transaction succeeded
+	LoadedWritableAddresses [][]byte // 12, by the lookup tables of a v0 transaction
+	LoadedReadonlyAddresses [][]byte // 13
+}
+
+// encoder appends the fields, leaving out the zero scalars like proto3.
+type encoder []byte
+
+func (e *encoder) uint(num protowire.Number, v uint64) {
+	if v != 0 {
+		*e = protowire.AppendTag(*e, num, protowire.VarintType)
+		*e = protowire.AppendVarint(*e, v)
+	}
+}
+
+// optional appends a field present even when it's zero.
+func (e *encoder) optional(num protowire.Number, v uint64) {
+	*e = protowire.AppendTag(*e, num, protowire.VarintType)
+	*e = protowire.AppendVarint(*e, v)
+}
+
+func (e *encoder) bool(num protowire.Number, v bool) {
+	if v {
+		e.uint(num, 1)
+	}
+}
+
+func (e *encoder) bytes(num protowire.Number, v []byte) {
+	*e = protowire.AppendTag(*e, num, protowire.BytesType)
+	*e = protowire.AppendBytes(*e, v)
+}
+
+func (e *encoder) string(num protowire.Number, v string) {
+	if v != "" {
+		e.bytes(num, []byte(v))
+	}
+}
+
+func (e *encoder) message(num protowire.Number, encode func(e *encoder)) {
+	var m encoder
+	encode(&m)
+	e.bytes(num, m)
+}
+
+// decode calls field with each field of b, and skips the fields it leaves
+// alone by returning 0.
+func decode(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		n, err := field(num, typ, b)
+		if err != nil {
+			return fmt.Errorf("field %d: %w", num, err)
+		}
+		if n == 0 {
+			if n = protowire.ConsumeFieldValue(num, typ, b); n < 0 {
+				return protowire.ParseError(n)
+			}
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func varint(typ protowire.Type, b []byte, v *uint64) (int, error) {
+	if typ != protowire.VarintType {
+		return 0, fmt.Errorf("wire type %d, want varint", typ)
+	}
+	x, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*v = x
+	return n, nil
+}
+
+func uint32Field(typ protowire.Type, b []byte, v *uint32) (int, error) {
+	var x uint64
+	n, err := varint(typ, b, &x)
+	*v = uint32(x)
+	return n, err
+}
+
+func boolField(typ protowire.Type, b []byte, v *bool) (int, error) {
+	var x uint64
+	n, err := varint(typ, b, &x)
+	*v = x != 0
+	return n, err
+}
+
+// bytesField decodes a length delimited field, a copy of b's bytes.
+func bytesField(typ protowire.Type, b []byte, v *[]byte) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, fmt.Errorf("wire type %d, want bytes", typ)
+	}
+	x, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*v = append([]byte{}, x...)
+	return n, nil
+}
+
+func stringField(typ protowire.Type, b []byte, v *string) (int, error) {
+	var x []byte
+	n, err := bytesField(typ, b, &x)
+	*v = string(x)
+	return n, err
+}
+
+func messageField(typ protowire.Type, b []byte, unmarshal func(b []byte) error) (int, error) {
+	var x []byte
+	n, err := bytesField(typ, b, &x)
+	if err != nil {
+		return n, err
+	}
+	return n, unmarshal(x)
+}
+
+func (r *SubscribeRequest) Marshal() []byte {
+	var e encoder
+	for name, filter := range r.Blocks {
+		e.message(4, func(e *encoder) {
+			e.bytes(1, []byte(name))
+			e.message(2, filter.marshal)
+		})
+	}
+	if r.Commitment != nil {
+		e.optional(6, uint64(*r.Commitment))
+	}
+	if r.Ping != nil {
+		e.message(9, func(e *encoder) { e.uint(1, uint64(r.Ping.ID)) })
+	}
+	return e
+}
+
+func (r *SubscribeRequest) Unmarshal(b []byte) error {
+	return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 4:
+			var name string
+			var filter BlocksFilter
+			n, err := messageField(typ, b, func(b []byte) error {
+				return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+					switch num {
+					case 1:
+						return stringField(typ, b, &name)
+					case 2:
+						return messageField(typ, b, filter.unmarshal)
+					}
+					return 0, nil
+				})
+			})
+			if r.Blocks == nil {
+				r.Blocks = make(map[string]BlocksFilter)
+			}
+			r.Blocks[name] = filter
+			return n, err
+		case 6:
+			var v uint64
+			n, err := varint(typ, b, &v)
+			level := CommitmentLevel(v)
+			r.Commitment = &level
+			return n, err
+		case 9:
+			r.Ping = &Ping{}
+			return messageField(typ, b, func(b []byte) error {
+				return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+					if num == 1 {
+						var v uint64
+						n, err := varint(typ, b, &v)
+						r.Ping.ID = int32(v)
+						return n, err
+					}
+					return 0, nil
+				})
+			})
+		}
+		return 0, nil
+	})
+}
+
+func (f *BlocksFilter) marshal(e *encoder) {
+	for _, account := range f.AccountInclude {
+		e.bytes(1, []byte(account))
+	}
+	for i, v := range []*bool{f.IncludeTransactions, f.IncludeAccounts, f.IncludeEntries} {
+		if v != nil {
+			e.optional(protowire.Number(i+2), protowire.EncodeBool(*v))
+		}
+	}
+}
+
+func (f *BlocksFilter) unmarshal(b []byte) error {
+	return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		var v bool
+		switch num {
+		case 1:
+			var account string
+			n, err := stringField(typ, b, &account)
+			f.AccountInclude = append(f.AccountInclude, account)
+			return n, err
+		case 2:
+			f.IncludeTransactions = &v
+		case 3:
+			f.IncludeAccounts = &v
+		case 4:
+			f.IncludeEntries = &v
+		default:
+			return 0, nil
+		}
+		return boolField(typ, b, &v)
+	})
+}
+
+func (u *SubscribeUpdate) Marshal() []byte {
+	var e encoder
+	for _, filter := range u.Filters {
+		e.bytes(1, []byte(filter))
+	}
+	if u.Block != nil {
+		e.message(5, u.Block.marshal)
+	}
+	if u.Ping {
+		e.message(6, func(*encoder) {})
+	}
+	return e
+}
+
+func (u *SubscribeUpdate) Unmarshal(b []byte) error {
+	return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			var filter string
+			n, err := stringField(typ, b, &filter)
+			u.Filters = append(u.Filters, filter)
+			return n, err
+		case 5:
+			u.Block = &Block{}
+			return messageField(typ, b, u.Block.unmarshal)
+		case 6:
+			u.Ping = true
+		}
+		return 0, nil
+	})
+}
+
+func (blk *Block) marshal(e *encoder) {
+	e.uint(1, blk.Slot)
+	e.string(2, blk.Blockhash)
+	if blk.BlockTime != nil {
+		e.message(4, func(e *encoder) { e.uint(1, uint64(*blk.BlockTime)) })
+	}
+	if blk.BlockHeight != nil {
+		e.message(5, func(e *encoder) { e.uint(1, *blk.BlockHeight) })
+	}
+	for i := range blk.Transactions {
+		e.message(6, blk.Transactions[i].marshal)
+	}
+	e.uint(7, blk.ParentSlot)
+	e.string(8, blk.ParentBlockhash)
+}
+
+func (blk *Block) unmarshal(b []byte) error {
+	return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return varint(typ, b, &blk.Slot)
+		case 2:
+			return stringField(typ, b, &blk.Blockhash)
+		case 4:
+			var at uint64
+			blk.BlockTime = new(int64)
+			n, err := messageField(typ, b, func(b []byte) error { return decodeFirst(b, &at) })
+			*blk.BlockTime = int64(at)
+			return n, err
+		case 5:
+			blk.BlockHeight = new(uint64)
+			return messageField(typ, b, func(b []byte) error { return decodeFirst(b, blk.BlockHeight) })
+		case 6:
+			var tx TransactionInfo
+			n, err := messageField(typ, b, tx.unmarshal)
+			blk.Transactions = append(blk.Transactions, tx)
+			return n, err
+		case 7:
+			return varint(typ, b, &blk.ParentSlot)
+		case 8:
+			return stringField(typ, b, &blk.ParentBlockhash)
+		}
+		return 0, nil
+	})
+}
+
+// decodeFirst decodes the varint field 1 of the wrapper messages.
+func decodeFirst(b []byte, v *uint64) error {
+	return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num == 1 {
+			return varint(typ, b, v)
+		}
+		return 0, nil
+	})
+}
+
+func (tx *TransactionInfo) marshal(e *encoder) {
+	e.bytes(1, tx.Signature)
+	e.bool(2, tx.IsVote)
+	if tx.Transaction != nil {
+		e.message(3, tx.Transaction.marshal)
+	}
+	if tx.Meta != nil {
+		e.message(4, tx.Meta.marshal)
+	}
+	e.uint(5, tx.Index)
+}
+
+func (tx *TransactionInfo) unmarshal(b []byte) error {
+	return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return bytesField(typ, b, &tx.Signature)
+		case 2:
+			return boolField(typ, b, &tx.IsVote)
+		case 3:
+			tx.Transaction = &Transaction{}
+			return messageField(typ, b, tx.Transaction.unmarshal)
+		case 4:
+			tx.Meta = &Meta{}
+			return messageField(typ, b, tx.Meta.unmarshal)
+		case 5:
+			return varint(typ, b, &tx.Index)
+		}
+		return 0, nil
+	})
+}
+
+func (tx *Transaction) marshal(e *encoder) {
+	for _, sig := range tx.Signatures {
+		e.bytes(1, sig)
+	}
+	if tx.Message != nil {
+		e.message(2, tx.Message.marshal)
+	}
+}
+
+func (tx *Transaction) unmarshal(b []byte) error {
+	return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			var sig []byte
+			n, err := bytesField(typ, b, &sig)
+			tx.Signatures = append(tx.Signatures, sig)
+			return n, err
+		case 2:
+			tx.Message = &Message{}
+			return messageField(typ, b, tx.Message.unmarshal)
+		}
+		return 0, nil
+	})
+}
+
+func (m *Message) marshal(e *encoder) {
+	if m.Header != nil {
+		e.message(1, func(e *encoder) {
+			e.uint(1, uint64(m.Header.NumRequiredSignatures))
+			e.uint(2, uint64(m.Header.NumReadonlySignedAccounts))
+			e.uint(3, uint64(m.Header.NumReadonlyUnsignedAccounts))
+		})
+	}
+	for _, key := range m.AccountKeys {
+		e.bytes(2, key)
+	}
+	e.bytes(3, m.RecentBlockhash)
+	for _, inst := range m.Instructions {
+		inst := inst
+		e.message(4, func(e *encoder) {
+			e.uint(1, uint64(inst.ProgramIDIndex))
+			e.bytes(2, inst.Accounts)
+			e.bytes(3, inst.Data)
+		})
+	}
+	e.bool(5, m.Versioned)
+	for _, lookup := range m.AddressTableLookups {
+		lookup := lookup
+		e.message(6, func(e *encoder) {
+			e.bytes(1, lookup.AccountKey)
+			e.bytes(2, lookup.WritableIndexes)
+			e.bytes(3, lookup.ReadonlyIndexes)
+		})
+	}
+}
+
+func (m *Message) unmarshal(b []byte) error {
+	return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			m.Header = &MessageHeader{}
+			return messageField(typ, b, func(b []byte) error {
+				return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+					switch num {
+					case 1:
+						return uint32Field(typ, b, &m.Header.NumRequiredSignatures)
+					case 2:
+						return uint32Field(typ, b, &m.Header.NumReadonlySignedAccounts)
+					case 3:
+						return uint32Field(typ, b, &m.Header.NumReadonlyUnsignedAccounts)
+					}
+					return 0, nil
+				})
+			})
+		case 2:
+			var key []byte
+			n, err := bytesField(typ, b, &key)
+			m.AccountKeys = append(m.AccountKeys, key)
+			return n, err
+		case 3:
+			return bytesField(typ, b, &m.RecentBlockhash)
+		case 4:
+			var inst CompiledInstruction
+			n, err := messageField(typ, b, func(b []byte) error {
+				return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+					switch num {
+					case 1:
+						return uint32Field(typ, b, &inst.ProgramIDIndex)
+					case 2:
+						return bytesField(typ, b, &inst.Accounts)
+					case 3:
+						return bytesField(typ, b, &inst.Data)
+					}
+					return 0, nil
+				})
+			})
+			m.Instructions = append(m.Instructions, inst)
+			return n, err
+		case 5:
+			return boolField(typ, b, &m.Versioned)
+		case 6:
+			var lookup AddressTableLookup
+			n, err := messageField(typ, b, func(b []byte) error {
+				return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+					switch num {
+					case 1:
+						return bytesField(typ, b, &lookup.AccountKey)
+					case 2:
+						return bytesField(typ, b, &lookup.WritableIndexes)
+					case 3:
+						return bytesField(typ, b, &lookup.ReadonlyIndexes)
+					}
+					return 0, nil
+				})
+			})
+			m.AddressTableLookups = append(m.AddressTableLookups, lookup)
+			return n, err
+		}
+		return 0, nil
+	})
+}
+
+func (m *Meta) marshal(e *encoder) {
+	if m.Err != nil {
+		e.message(1, func(e *encoder) { e.bytes(1, m.Err) })
+	}
+	for _, address := range m.LoadedWritableAddresses {
+		e.bytes(12, address)
+	}
+	for _, address := range m.LoadedReadonlyAddresses {
+		e.bytes(13, address)
+	}
+}
+
+func (m *Meta) unmarshal(b []byte) error {
+	return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			m.Err = []byte{}
+			return messageField(typ, b, func(b []byte) error {
+				return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+					if num == 1 {
+						return bytesField(typ, b, &m.Err)
+					}
+					return 0, nil
+				})
+			})
+		case 12:
+			var address []byte
+			n, err := bytesField(typ, b, &address)
+			m.LoadedWritableAddresses = append(m.LoadedWritableAddresses, address)
+			return n, err
+		case 13:
+			var address []byte
+			n, err := bytesField(typ, b, &address)
+			m.LoadedReadonlyAddresses = append(m.LoadedReadonlyAddresses, address)
+			return n, err
+		}
+		return 0, nil
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"sol_block_extractord/finished_block_manager"
+	"sol_block_extractord/geyser"
+	"sol_block_extractord/geyser/geysertest"
+	"sol_block_extractord/source"
+)
+
+func streamedBlock(slot, parent uint64) *geyser.SubscribeUpdate {
+	height, at := slot, int64(1700000000)
+	return &geyser.SubscribeUpdate{Block: &geyser.Block{
+		Slot: slot, ParentSlot: parent, BlockHeight: &height, BlockTime: &at,
+		Blockhash: "EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG", ParentBlockhash: "11111111111111111111111111111111",
+	}}
+}
+
+// TestStreamBlocks checks the streamed blocks are handed over in slot order,
+// the slots the stream missed fetched from the source.
+func TestStreamBlocks(t *testing.T) {
+	server, err := geysertest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+	client, err := geyser.Dial(server.Addr, "", false)
+	require.NoError(t, err)
+	defer client.Close()
+
+	src := source.NewMemory()
+	src.Add(10, emptyBlock(9, "EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG"))
+	src.Add(12, emptyBlock(10, "11111111111111111111111111111111"))
+	src.Add(16, emptyBlock(15, "11111111111111111111111111111111"))
+
+	server.Send(streamedBlock(9, 8))   // before the start slot
+	server.Send(streamedBlock(13, 12)) // 10 to 12 before the stream
+	server.Send(streamedBlock(15, 13)) // 14 skipped
+	server.Send(streamedBlock(17, 16)) // 16 missed
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tracker := finished_block_manager.NewMemoryTracker(10)
+	blockCh := make(chan SlotBlock)
+	go SOLStreamBlocks(ctx, client, src, 10, 2, tracker, blockCh)
+
+	var slots []uint64
+	for len(slots) < 6 {
+		select {
+		case b := <-blockCh:
+			slots = append(slots, b.Slot)
+			tracker.Update(b.Slot)
+		case <-ctx.Done():
+			t.Fatalf("blocks handed over: %v", slots)
+		}
+	}
+	require.Equal(t, []uint64{10, 12, 13, 15, 16, 17}, slots)
+
+	cancel()
+	_, open := <-blockCh
+	require.False(t, open)
+}
@@ -0,0 +1,137 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"sol_block_extractord/log"
+	"sol_block_extractord/metrics"
+)
+
+const checkTimeout = 3 * time.Second
+
+// Check reports whether a dependency responds.
+type Check func(ctx context.Context) error
+
+type Response struct {
+	Status string            `json:"status"` // ok or failing
+	Checks map[string]string `json:"checks"` // ok or the failure by check
+}
+
+// Checker serves /healthz, failing when the finished slot hasn't moved within
+// the stall window or lags too far behind the head, and /readyz, failing
+// until the postgres check and one of the RPC checks pass.
+type Checker struct {
+	stallWindow time.Duration
+	maxLag      uint64
+	postgres    Check
+	rpc         []Check
+
+	started time.Time
+}
+
+// New checks postgres unless it's nil, the zero stallWindow and maxLag are
+// never exceeded.
+func New(stallWindow time.Duration, maxLag uint64, postgres Check, rpc ...Check) *Checker {
+	return &Checker{stallWindow: stallWindow, maxLag: maxLag, postgres: postgres, rpc: rpc, started: time.Now()}
+}
+
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", c.healthz)
+	mux.HandleFunc("/readyz", c.readyz)
+}
+
+func (c *Checker) Health() Response {
+	checks := make(map[string]string)
+	ok := true
+
+	// before the first slot is finished the process start counts as the last advance
+	last := metrics.FinishedAt()
+	if last.IsZero() {
+		last = c.started
+	}
+	if stalled := time.Since(last); c.stallWindow > 0 && stalled > c.stallWindow {
+		checks["progress"] = fmt.Sprintf("finished slot %d not advanced for %v", metrics.Finished(), stalled.Truncate(time.Second))
+		ok = false
+	} else {
+		checks["progress"] = "ok"
+	}
+
+	if lag := metrics.Lag(); c.maxLag > 0 && lag > c.maxLag {
+		checks["lag"] = fmt.Sprintf("%d slots behind the head, more than %d", lag, c.maxLag)
+		ok = false
+	} else {
+		checks["lag"] = "ok"
+	}
+
+	return response(ok, checks)
+}
+
+func (c *Checker) Ready(ctx context.Context) Response {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	checks := make(map[string]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	run := func(name string, check Check) {
+		defer wg.Done()
+		result := "ok"
+		if err := check(ctx); err != nil {
+			result = err.Error()
+		}
+		mu.Lock()
+		checks[name] = result
+		mu.Unlock()
+	}
+
+	if c.postgres != nil {
+		wg.Add(1)
+		go run("postgres", c.postgres)
+	}
+	for i, check := range c.rpc {
+		wg.Add(1)
+		go run(fmt.Sprintf("rpc%d", i), check)
+	}
+	wg.Wait()
+
+	ready := c.postgres == nil || checks["postgres"] == "ok"
+	rpcOK := len(c.rpc) == 0 // one endpoint responding is enough
+	for i := range c.rpc {
+		rpcOK = rpcOK || checks[fmt.Sprintf("rpc%d", i)] == "ok"
+	}
+	return response(ready && rpcOK, checks)
+}
+
+func response(ok bool, checks map[string]string) Response {
+	if ok {
+		return Response{Status: "ok", Checks: checks}
+	}
+	return Response{Status: "failing", Checks: checks}
+}
+
+func writeResponse(w http.ResponseWriter, r Response) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Status == "ok" {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(r); err != nil {
+		log.Logger.Warn("health write response failed", zap.Error(err))
+	}
+}
+
+func (c *Checker) healthz(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, c.Health())
+}
+
+func (c *Checker) readyz(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, c.Ready(r.Context()))
+}
@@ -0,0 +1,64 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"sol_block_extractord/metrics"
+)
+
+func get(t *testing.T, c *Checker, path string) (int, Response) {
+	mux := http.NewServeMux()
+	c.Register(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var r Response
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+	return rec.Code, r
+}
+
+func TestHealthz(t *testing.T) {
+	c := New(50*time.Millisecond, 100, nil)
+	metrics.SetFinished(1000)
+	metrics.SetHead(1050)
+
+	code, r := get(t, c, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, Response{Status: "ok", Checks: map[string]string{"progress": "ok", "lag": "ok"}}, r)
+
+	metrics.SetHead(1101)
+	time.Sleep(60 * time.Millisecond)
+	code, r = get(t, c, "/healthz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "failing", r.Status)
+	require.Contains(t, r.Checks["progress"], "finished slot 1000 not advanced")
+	require.Equal(t, "101 slots behind the head, more than 100", r.Checks["lag"])
+
+	metrics.SetFinished(1101)
+	code, _ = get(t, c, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+}
+
+func TestReadyz(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	code, r := get(t, New(0, 0, ok, down, ok), "/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]string{"postgres": "ok", "rpc0": "connection refused", "rpc1": "ok"}, r.Checks)
+
+	code, _ = get(t, New(0, 0, down, ok), "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+
+	code, r = get(t, New(0, 0, nil, down), "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, map[string]string{"rpc0": "connection refused"}, r.Checks)
+}
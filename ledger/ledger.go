@@ -0,0 +1,205 @@
+package ledger
+
+import (
+	"sync"
+
+	"github.com/holiman/uint256"
+
+	"sol_block_extractord/types"
+)
+
+const (
+	ReasonInsufficientBalance = "insufficient balance"
+	ReasonListingNotFound     = "listing not found"
+	ReasonWrongPayee          = "payment not to the seller"
+	ReasonUnderpaid           = "payment below the listing price"
+	ReasonNotSeller           = "only the seller can cancel"
+	ReasonMaxSupply           = "mint above the max supply"
+	ReasonMintLim             = "mint amt above the lim"
+)
+
+type Supply struct {
+	Max         int64
+	Minted      int64
+	Burned      int64
+	Circulating int64
+}
+
+// Listing is an amount escrowed by a list op until it's bought or cancelled.
+type Listing struct {
+	Seller string
+	Amt    int64
+	Price  int64 // lamports for the whole amount
+}
+
+// Ledger holds the balances and open listings derived from the accepted
+// operations, applied in (height, txIdx, instIdx) order.
+type Ledger struct {
+	mu       sync.RWMutex
+	balances map[string]int64
+	listings map[string]Listing // by list tx hash
+	minted   map[string]int64   // by minter
+	supply   Supply
+
+	lim        int64 // per mint, from the deploy op
+	mintSlot   uint64
+	slotMinted int64
+
+	applied map[opKey]struct{}
+}
+
+// opKey identifies an operation, a transaction may carry several memos.
+type opKey struct {
+	txHash  string
+	instIdx int
+}
+
+func New() *Ledger {
+	return &Ledger{balances: make(map[string]int64), listings: make(map[string]Listing), minted: make(map[string]int64), applied: make(map[opKey]struct{})}
+}
+
+// MintedBy is the total amt addr has minted.
+func (l *Ledger) MintedBy(addr string) int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.minted[addr]
+}
+
+// MintedAt is the total amt minted at slot, only the latest slot is kept.
+func (l *Ledger) MintedAt(slot uint64) int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if slot != l.mintSlot {
+		return 0
+	}
+	return l.slotMinted
+}
+
+func (l *Ledger) Balance(addr string) int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.balances[addr]
+}
+
+// Balances is a copy of the non-zero balances.
+func (l *Ledger) Balances() map[string]int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	balances := make(map[string]int64, len(l.balances))
+	for addr, amt := range l.balances {
+		balances[addr] = amt
+	}
+	return balances
+}
+
+func (l *Ledger) Listing(txHash string) (Listing, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	listing, ok := l.listings[txHash]
+	return listing, ok
+}
+
+func (l *Ledger) Supply() Supply {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.supply
+}
+
+// Applied reports whether op has been applied already, for operations
+// replayed after they have been persisted and for the ones a backfill merges
+// behind the applied ones.
+func (l *Ledger) Applied(op types.Operation) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.applied[opKey{op.TxHash, op.InstIdx}]
+	return ok
+}
+
+// Check validates op against the current balances without applying it.
+func (l *Ledger) Check(op types.Operation) (bool, string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	switch op.M.Op {
+	case types.OpMint:
+		// the max and lim apply once the deploy op has been applied
+		if l.supply.Max != 0 && l.supply.Minted+op.M.AmtN > l.supply.Max {
+			return false, ReasonMaxSupply
+		}
+		if l.lim != 0 && op.M.AmtN > l.lim {
+			return false, ReasonMintLim
+		}
+	case types.OpTransfer, types.OpBurn, types.OpList:
+		if l.balances[op.From] < op.M.AmtN {
+			return false, ReasonInsufficientBalance
+		}
+	case types.OpBuy:
+		listing, ok := l.listings[op.M.Listing]
+		if !ok {
+			return false, ReasonListingNotFound
+		}
+		if op.To != listing.Seller {
+			return false, ReasonWrongPayee
+		}
+		if op.Value == nil || op.Value.Lt(uint256.NewInt(uint64(listing.Price))) {
+			return false, ReasonUnderpaid
+		}
+	case types.OpCancel:
+		listing, ok := l.listings[op.M.Listing]
+		if !ok {
+			return false, ReasonListingNotFound
+		}
+		if op.From != listing.Seller {
+			return false, ReasonNotSeller
+		}
+	}
+	return true, ""
+}
+
+func (l *Ledger) Apply(op types.Operation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch op.M.Op {
+	case types.OpDeploy:
+		l.supply.Max = op.M.MaxN
+		l.lim = op.M.LimN
+	case types.OpMint:
+		l.balances[op.From] += op.M.AmtN
+		l.minted[op.From] += op.M.AmtN
+		if op.Slot != l.mintSlot {
+			l.mintSlot = op.Slot
+			l.slotMinted = 0
+		}
+		l.slotMinted += op.M.AmtN
+		l.supply.Minted += op.M.AmtN
+		l.supply.Circulating += op.M.AmtN
+	case types.OpTransfer:
+		l.debit(op.From, op.M.AmtN)
+		l.balances[op.To] += op.M.AmtN
+	case types.OpBurn:
+		l.debit(op.From, op.M.AmtN)
+		l.supply.Burned += op.M.AmtN
+		l.supply.Circulating -= op.M.AmtN
+	case types.OpList:
+		l.debit(op.From, op.M.AmtN)
+		l.listings[op.TxHash] = Listing{Seller: op.From, Amt: op.M.AmtN, Price: op.M.PriceN}
+	case types.OpBuy:
+		listing := l.listings[op.M.Listing]
+		delete(l.listings, op.M.Listing)
+		l.balances[op.From] += listing.Amt
+	case types.OpCancel:
+		listing := l.listings[op.M.Listing]
+		delete(l.listings, op.M.Listing)
+		l.balances[listing.Seller] += listing.Amt
+	}
+
+	l.applied[opKey{op.TxHash, op.InstIdx}] = struct{}{}
+}
+
+func (l *Ledger) debit(addr string, amt int64) {
+	l.balances[addr] -= amt
+	if l.balances[addr] == 0 {
+		delete(l.balances, addr)
+	}
+}
@@ -0,0 +1,133 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	"sol_block_extractord/types"
+)
+
+func newOp(height uint64, txIdx int, op, from, to string, amt int64) types.Operation {
+	return types.Operation{Slot: height, BlockHeight: height, TxIdx: txIdx, From: from, To: to, M: types.Memo{Op: op, AmtN: amt, MaxN: amt}}
+}
+
+func TestBurn(t *testing.T) {
+	l := New()
+	l.Apply(newOp(1, 0, types.OpDeploy, "a", "", 1000))
+	l.Apply(newOp(2, 0, types.OpMint, "a", "", 100))
+	l.Apply(newOp(2, 1, types.OpMint, "b", "", 100))
+
+	burn := newOp(3, 0, types.OpBurn, "a", "", 101)
+	pass, reason := l.Check(burn)
+	require.False(t, pass)
+	require.Equal(t, ReasonInsufficientBalance, reason)
+
+	burn.M.AmtN = 40
+	pass, _ = l.Check(burn)
+	require.True(t, pass)
+	l.Apply(burn)
+
+	require.Equal(t, int64(60), l.Balance("a"))
+	require.Equal(t, Supply{Max: 1000, Minted: 200, Burned: 40, Circulating: 160}, l.Supply())
+
+	l.Apply(newOp(3, 1, types.OpTransfer, "b", "a", 100))
+	require.Equal(t, int64(160), l.Balance("a"))
+	require.Equal(t, int64(0), l.Balance("b"))
+	require.Equal(t, int64(160), l.Supply().Circulating)
+}
+
+func TestMintSupply(t *testing.T) {
+	l := New()
+	deploy := newOp(1, 0, types.OpDeploy, "a", "", 250)
+	deploy.M.LimN = 100
+	l.Apply(deploy)
+
+	mint := newOp(2, 0, types.OpMint, "a", "", 101)
+	_, reason := l.Check(mint)
+	require.Equal(t, ReasonMintLim, reason)
+
+	mint.M.AmtN = 100
+	pass, _ := l.Check(mint)
+	require.True(t, pass)
+	l.Apply(mint)
+	l.Apply(newOp(2, 1, types.OpMint, "b", "", 100))
+	require.Equal(t, int64(200), l.MintedAt(2))
+
+	// the block height of a slot may be lower after skipped slots, the cap is by slot
+	mint = newOp(3, 0, types.OpMint, "c", "", 51)
+	mint.BlockHeight = 2
+	require.Equal(t, int64(0), l.MintedAt(mint.Slot))
+	_, reason = l.Check(mint)
+	require.Equal(t, ReasonMaxSupply, reason)
+}
+
+func TestApplied(t *testing.T) {
+	l := New()
+	require.False(t, l.Applied(newOp(0, 0, types.OpMint, "a", "", 1)))
+
+	op := newOp(5, 2, types.OpMint, "a", "", 1)
+	op.TxHash = "tx5"
+	l.Apply(op)
+	require.True(t, l.Applied(op))
+
+	// an earlier operation merged by a backfill isn't applied yet
+	earlier := newOp(4, 9, types.OpMint, "a", "", 1)
+	earlier.TxHash = "tx4"
+	require.False(t, l.Applied(earlier))
+
+	op.InstIdx = 1
+	require.False(t, l.Applied(op))
+}
+
+func TestMarket(t *testing.T) {
+	l := New()
+	l.Apply(newOp(1, 0, types.OpMint, "seller", "", 100))
+
+	list := newOp(2, 0, types.OpList, "seller", "", 60)
+	list.TxHash = "list1"
+	list.M.PriceN = 1000
+	pass, _ := l.Check(list)
+	require.True(t, pass)
+	l.Apply(list)
+	require.Equal(t, int64(40), l.Balance("seller"))
+	require.Equal(t, int64(100), l.Supply().Circulating)
+
+	buy := newOp(3, 0, types.OpBuy, "buyer", "seller", 0)
+	buy.M.Listing = "unknown"
+	buy.Value = uint256.NewInt(1000)
+	_, reason := l.Check(buy)
+	require.Equal(t, ReasonListingNotFound, reason)
+
+	buy.M.Listing = "list1"
+	buy.To = "other"
+	_, reason = l.Check(buy)
+	require.Equal(t, ReasonWrongPayee, reason)
+
+	buy.To = "seller"
+	buy.Value = uint256.NewInt(999)
+	_, reason = l.Check(buy)
+	require.Equal(t, ReasonUnderpaid, reason)
+
+	cancel := newOp(3, 1, types.OpCancel, "buyer", "", 0)
+	cancel.M.Listing = "list1"
+	_, reason = l.Check(cancel)
+	require.Equal(t, ReasonNotSeller, reason)
+
+	buy.Value = uint256.NewInt(1000)
+	pass, _ = l.Check(buy)
+	require.True(t, pass)
+	l.Apply(buy)
+	require.Equal(t, int64(60), l.Balance("buyer"))
+	_, ok := l.Listing("list1")
+	require.False(t, ok)
+
+	list.BlockHeight, list.TxHash = 4, "list2"
+	l.Apply(list)
+	cancel.BlockHeight, cancel.From, cancel.M.Listing = 5, "seller", "list2"
+	pass, _ = l.Check(cancel)
+	require.True(t, pass)
+	l.Apply(cancel)
+	require.Equal(t, int64(40), l.Balance("seller"))
+}
@@ -1,9 +1,72 @@
 package log
 
-import "go.uber.org/zap"
+import (
+	"fmt"
 
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// Logger is the development logger until Setup replaces it with the
+// configured one.
 var Logger *zap.Logger
 
 func init() {
 	Logger, _ = zap.NewDevelopment()
 }
+
+// Options configure the Logger. With sampling, of the entries logged with the
+// same level and message every second, the first SampleInitial are kept and
+// then one in SampleThereafter, SampleInitial 0 disables it.
+type Options struct {
+	Level            string // debug, info, warn or error
+	Format           string // json or console, console when empty
+	SampleInitial    int
+	SampleThereafter int
+}
+
+// New builds the logger o describes.
+func New(o Options) (*zap.Logger, error) {
+	level, err := zapcore.ParseLevel(o.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := zap.NewProductionConfig()
+	cfg.Level = zap.NewAtomicLevelAt(level)
+	if o.Format == "" {
+		o.Format = FormatConsole
+	}
+	switch o.Format {
+	case FormatJSON:
+		cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	case FormatConsole:
+		cfg.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return nil, fmt.Errorf("unknown log format %q", o.Format)
+	}
+	cfg.Encoding = o.Format
+
+	cfg.Sampling = nil
+	if o.SampleInitial > 0 {
+		cfg.Sampling = &zap.SamplingConfig{Initial: o.SampleInitial, Thereafter: o.SampleThereafter}
+	}
+
+	return cfg.Build()
+}
+
+// Setup replaces Logger with the one o describes.
+func Setup(o Options) error {
+	logger, err := New(o)
+	if err != nil {
+		return err
+	}
+	Logger.Sync()
+	Logger = logger
+	return nil
+}
@@ -0,0 +1,24 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNew(t *testing.T) {
+	logger, err := New(Options{Level: "warn", Format: FormatJSON, SampleInitial: 1, SampleThereafter: 10})
+	require.NoError(t, err)
+	require.False(t, logger.Core().Enabled(zapcore.InfoLevel))
+	require.True(t, logger.Core().Enabled(zapcore.WarnLevel))
+
+	logger, err = New(Options{Level: "debug"})
+	require.NoError(t, err)
+	require.True(t, logger.Core().Enabled(zapcore.DebugLevel))
+
+	_, err = New(Options{Level: "verbose"})
+	require.Error(t, err)
+	_, err = New(Options{Level: "info", Format: "text"})
+	require.EqualError(t, err, `unknown log format "text"`)
+}
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "extractord"
+
+const (
+	StageFilter = "filter" // the business rules, before the ordered pipeline
+	StageLedger = "ledger" // the balances and mint caps, in the ordered pipeline
+)
+
+var (
+	headSlot     atomic.Uint64
+	finishedSlot atomic.Uint64
+	finishedAt   atomic.Int64 // unix nano
+
+	headSlotGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "head_slot",
+		Help:      "The latest slot of the chain at the indexed commitment.",
+	})
+	finishedSlotGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "finished_slot",
+		Help:      "The latest slot whose operations are all committed to the pipeline.",
+	})
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "lag_slots",
+		Help:      "The slots between the head and the finished slot.",
+	}, func() float64 {
+		return float64(Lag())
+	})
+
+	GetBlockSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "get_block_seconds",
+		Help:      "The GetBlock calls latency by worker.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"worker"})
+	RPCErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_errors_total",
+		Help:      "The failed RPC calls by method and JSON-RPC error code, transport for the errors without one.",
+	}, []string{"method", "code"})
+
+	rejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rejections_total",
+		Help:      "The rejected operations by stage and reason.",
+	}, []string{"stage", "reason"})
+
+	Rollbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rollbacks_total",
+		Help:      "The rollbacks of the provisional operations from a slot the finalized chain doesn't have.",
+	})
+
+	InsertSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "pg_insert_seconds",
+		Help:      "The postgres batch transactions latency.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	})
+	InsertRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pg_insert_retries_total",
+		Help:      "The postgres batch transactions retried.",
+	})
+)
+
+func SetHead(slot uint64) {
+	headSlot.Store(slot)
+	headSlotGauge.Set(float64(slot))
+}
+
+func SetFinished(slot uint64) {
+	finishedSlot.Store(slot)
+	finishedAt.Store(time.Now().UnixNano())
+	finishedSlotGauge.Set(float64(slot))
+}
+
+func Head() uint64 {
+	return headSlot.Load()
+}
+
+func Finished() uint64 {
+	return finishedSlot.Load()
+}
+
+// FinishedAt is when the finished slot was last set, zero before.
+func FinishedAt() time.Time {
+	if at := finishedAt.Load(); at != 0 {
+		return time.Unix(0, at)
+	}
+	return time.Time{}
+}
+
+// Lag is 0 until the head is known.
+func Lag() uint64 {
+	head, finished := Head(), Finished()
+	if head <= finished {
+		return 0
+	}
+	return head - finished
+}
+
+// Rejection counts a rejected operation, the reason is cut at the first
+// colon, the details after it aren't bounded.
+func Rejection(stage, reason string) {
+	reason, _, _ = strings.Cut(reason, ":")
+	rejections.WithLabelValues(stage, reason).Inc()
+}
+
+// ChannelDepth exposes the length of a channel, it's meant to be called once
+// per channel.
+func ChannelDepth(channel string, depth func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "channel_depth",
+		Help:        "The items waiting in a pipeline channel.",
+		ConstLabels: prometheus.Labels{"channel": channel},
+	}, func() float64 {
+		return float64(depth())
+	})
+}
@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLag(t *testing.T) {
+	SetFinished(100)
+	require.Equal(t, uint64(0), Lag())
+
+	SetHead(130)
+	require.Equal(t, uint64(30), Lag())
+	require.Equal(t, float64(130), testutil.ToFloat64(headSlotGauge))
+}
+
+func TestRejection(t *testing.T) {
+	Rejection(StageFilter, "wrong p: brc-20")
+	Rejection(StageFilter, "wrong p: sol-20")
+	Rejection(StageLedger, "insufficient balance")
+
+	require.Equal(t, float64(2), testutil.ToFloat64(rejections.WithLabelValues(StageFilter, "wrong p")))
+	require.Equal(t, 2, testutil.CollectAndCount(rejections))
+}
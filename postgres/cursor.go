@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/gagliardetto/solana-go"
+
+	"sol_block_extractord/source"
+)
+
+// SignatureCursors keeps the cursors of the signatures ingestion in the
+// "SignatureCursor" table, a restart pages back to them.
+type SignatureCursors struct {
+	db *sql.DB
+}
+
+var _ source.Cursors = (*SignatureCursors)(nil)
+
+func NewSignatureCursors() (*SignatureCursors, error) {
+	db, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return &SignatureCursors{db: db}, nil
+}
+
+func (c *SignatureCursors) Cursor(account solana.PublicKey) (sig solana.Signature, slot uint64, err error) {
+	var stored string
+	err = c.db.QueryRow("SELECT signature, slot FROM \"SignatureCursor\" WHERE account = $1", account.String()).Scan(&stored, &slot)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sig, 0, nil
+	}
+	if err != nil {
+		return
+	}
+	sig, err = solana.SignatureFromBase58(stored)
+	return
+}
+
+func (c *SignatureCursors) SetCursor(account solana.PublicKey, sig solana.Signature, slot uint64) error {
+	_, err := c.db.Exec(
+		"INSERT INTO \"SignatureCursor\"(account, signature, slot, \"updatedAt\") VALUES($1, $2, $3, now()) ON CONFLICT (account) DO UPDATE SET signature = EXCLUDED.signature, slot = EXCLUDED.slot, \"updatedAt\" = now()",
+		account.String(), sig.String(), slot)
+	return err
+}
+
+func (c *SignatureCursors) Shutdown() {
+	c.db.Close()
+}
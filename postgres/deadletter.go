@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"sol_block_extractord/webhook"
+)
+
+// DeadLetters keeps the undelivered webhook payloads in the
+// "WebhookDeadLetter" table, to be replayed by hand.
+type DeadLetters struct {
+	db *sql.DB
+}
+
+var _ webhook.DeadLetters = (*DeadLetters)(nil)
+
+func NewDeadLetters() (*DeadLetters, error) {
+	db, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetters{db: db}, nil
+}
+
+func (d *DeadLetters) Add(dl webhook.DeadLetter) error {
+	_, err := d.db.Exec("INSERT INTO \"WebhookDeadLetter\"(subscription, url, delivery, payload, attempts, error, \"createdAt\") VALUES($1, $2, $3, $4, $5, $6, now())",
+		dl.Subscription, dl.URL, dl.Delivery, string(dl.Payload), dl.Attempts, dl.Err)
+	return err
+}
+
+func (d *DeadLetters) Shutdown() {
+	d.db.Close()
+}
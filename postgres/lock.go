@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"sol_block_extractord/config"
+)
+
+// ErrLedgerLocked means another process holds the ledger of the tick, a
+// start writing to it or a merge rebuilding it.
+var ErrLedgerLocked = errors.New("ledger locked by another process")
+
+// LedgerLock is a session advisory lock on the ledger of the configured tick,
+// held on its own connection until Unlock or the process exits.
+type LedgerLock struct {
+	db   *sql.DB
+	conn *sql.Conn
+}
+
+// LockLedger takes the lock, or returns ErrLedgerLocked right away when it's
+// held.
+func LockLedger() (lock *LedgerLock, err error) {
+	db, err := open()
+	if err != nil {
+		return
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		db.Close()
+		return
+	}
+
+	var locked bool
+	err = conn.QueryRowContext(context.Background(), "SELECT pg_try_advisory_lock(hashtext($1))", "ledger:"+config.Cfg.Biz.Ins.Tick).Scan(&locked)
+	if err == nil && !locked {
+		err = ErrLedgerLocked
+	}
+	if err != nil {
+		conn.Close()
+		db.Close()
+		return nil, err
+	}
+	return &LedgerLock{db: db, conn: conn}, nil
+}
+
+// Unlock releases the lock with the connection holding it.
+func (l *LedgerLock) Unlock() {
+	l.conn.Close()
+	l.db.Close()
+}
@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"sol_block_extractord/log"
+)
+
+// migrationFiles are the schema changes, each one additive: a daemon built
+// with fewer migrations keeps working on the newer schema, it only warns.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLock serializes the daemons migrating the same database.
+const migrationLock = 0x736f6c6578 // "solex"
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// loadMigrations reads the NNNN_name.sql files of fsys in version order.
+func loadMigrations(fsys fs.FS) (migrations []migration, err error) {
+	paths, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return
+	}
+
+	for _, p := range paths {
+		name := strings.TrimSuffix(path.Base(p), ".sql")
+		prefix, _, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s not named NNNN_name.sql", p)
+		}
+
+		bytes, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: name, sql: string(bytes)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i, m := range migrations {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration %s: expected version %d", m.name, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// SchemaVersion is the version of the migrations this daemon is built with.
+func SchemaVersion() (int, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	return len(migrations), err
+}
+
+func warnNewerSchema(version, supported int) {
+	log.Logger.Warn("database schema is newer than this daemon, its additional migrations are ignored", zap.Int("version", version), zap.Int("supported", supported))
+}
+
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// dbSchemaVersion is the latest migration applied to the database, 0 if none.
+func dbSchemaVersion(q querier) (version int, err error) {
+	var table sql.NullString
+	err = q.QueryRow("SELECT to_regclass('\"SchemaMigration\"')::text").Scan(&table)
+	if err != nil || !table.Valid {
+		return
+	}
+	err = q.QueryRow("SELECT COALESCE(MAX(version), 0) FROM \"SchemaMigration\"").Scan(&version)
+	return
+}
+
+// Migrate applies the pending migrations in one transaction and returns the
+// schema version of the database.
+func Migrate() (version int, err error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return
+	}
+
+	db, err := open()
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLock)
+	if err != nil {
+		return
+	}
+	_, err = tx.Exec("CREATE TABLE IF NOT EXISTS \"SchemaMigration\"(version INTEGER PRIMARY KEY, name TEXT NOT NULL, \"appliedAt\" TIMESTAMPTZ NOT NULL DEFAULT now())")
+	if err != nil {
+		return
+	}
+	version, err = dbSchemaVersion(tx)
+	if err != nil {
+		return
+	}
+	if version > len(migrations) {
+		warnNewerSchema(version, len(migrations))
+		return version, nil
+	}
+
+	for _, m := range migrations[version:] {
+		_, err = tx.Exec(m.sql)
+		if err != nil {
+			return version, fmt.Errorf("migration %s: %w", m.name, err)
+		}
+		_, err = tx.Exec("INSERT INTO \"SchemaMigration\"(version, name, \"appliedAt\") VALUES($1, $2, now())", m.version, m.name)
+		if err != nil {
+			return version, err
+		}
+		log.Logger.Info("migration applied", zap.String("migration", m.name))
+	}
+
+	return len(migrations), tx.Commit()
+}
+
+// CheckSchema refuses a database whose schema is older than the one this
+// daemon is built with, a newer one is only warned about.
+func CheckSchema() error {
+	expected, err := SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	db, err := open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	version, err := dbSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case version < expected:
+		return fmt.Errorf("database schema version %d is older than %d, run the migrate command or start with --pg_migrate", version, expected)
+	case version > expected:
+		warnNewerSchema(version, expected)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	require.NoError(t, err)
+	version, err := SchemaVersion()
+	require.NoError(t, err)
+	require.Equal(t, version, len(migrations))
+	for i, m := range migrations {
+		require.Equal(t, i+1, m.version)
+		require.NotEmpty(t, m.sql)
+	}
+
+	fsys := fstest.MapFS{
+		"migrations/0002_b.sql": {Data: []byte("SELECT 2")},
+		"migrations/0001_a.sql": {Data: []byte("SELECT 1")},
+	}
+	migrations, err = loadMigrations(fsys)
+	require.NoError(t, err)
+	require.Equal(t, "0001_a", migrations[0].name)
+	require.Equal(t, "SELECT 2", migrations[1].sql)
+
+	fsys["migrations/0004_d.sql"] = &fstest.MapFile{Data: []byte("SELECT 4")}
+	_, err = loadMigrations(fsys)
+	require.ErrorContains(t, err, "expected version 3")
+
+	_, err = loadMigrations(fstest.MapFS{"migrations/init.sql": {Data: []byte("SELECT 1")}})
+	require.Error(t, err)
+}
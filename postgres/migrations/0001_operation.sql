@@ -0,0 +1,20 @@
+-- the table the indexer has always written to, kept as is for the databases created before the migrations
+CREATE TABLE IF NOT EXISTS "Operation" (
+    id            BIGSERIAL PRIMARY KEY,
+    "from"        TEXT        NOT NULL,
+    "to"          TEXT        NOT NULL,
+    txhash        TEXT        NOT NULL,
+    "rawData"     TEXT        NOT NULL,
+    "blockHeight" BIGINT      NOT NULL,
+    p             TEXT        NOT NULL,
+    op            TEXT        NOT NULL,
+    tick          TEXT        NOT NULL,
+    amt           TEXT        NOT NULL DEFAULT '',
+    lim           TEXT        NOT NULL DEFAULT '',
+    max           TEXT        NOT NULL DEFAULT '',
+    value         TEXT        NOT NULL,
+    timestamp     BIGINT      NOT NULL,
+    "txIndex"     INTEGER     NOT NULL,
+    "createdAt"   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    "updatedAt"   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
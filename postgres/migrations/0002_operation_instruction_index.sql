@@ -0,0 +1,7 @@
+ALTER TABLE "Operation" ADD COLUMN IF NOT EXISTS "instIndex" INTEGER NOT NULL DEFAULT 0;
+
+CREATE UNIQUE INDEX IF NOT EXISTS "Operation_txhash_instIndex_key" ON "Operation" (txhash, "instIndex");
+CREATE INDEX IF NOT EXISTS "Operation_blockHeight_txIndex_idx" ON "Operation" ("blockHeight", "txIndex");
+CREATE INDEX IF NOT EXISTS "Operation_from_idx" ON "Operation" ("from");
+CREATE INDEX IF NOT EXISTS "Operation_to_idx" ON "Operation" ("to");
+CREATE INDEX IF NOT EXISTS "Operation_tick_op_idx" ON "Operation" (tick, op);
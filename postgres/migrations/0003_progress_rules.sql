@@ -0,0 +1,13 @@
+-- the finished slot per indexing process, see postgres.ProgressTracker
+CREATE TABLE IF NOT EXISTS "Progress" (
+    name        TEXT PRIMARY KEY,
+    slot        BIGINT      NOT NULL,
+    "updatedAt" TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- the business rules in force from a slot on, see postgres.RulesLog
+CREATE TABLE IF NOT EXISTS "RulesVersion" (
+    slot        BIGINT PRIMARY KEY,
+    rules       JSONB       NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT now()
+);
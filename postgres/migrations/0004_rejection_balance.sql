@@ -0,0 +1,25 @@
+-- the operations rejected against the ledger, like an insufficient balance
+CREATE TABLE IF NOT EXISTS "Rejection" (
+    id            BIGSERIAL PRIMARY KEY,
+    txhash        TEXT        NOT NULL,
+    "instIndex"   INTEGER     NOT NULL DEFAULT 0,
+    "blockHeight" BIGINT      NOT NULL,
+    "txIndex"     INTEGER     NOT NULL,
+    "from"        TEXT        NOT NULL,
+    op            TEXT        NOT NULL,
+    tick          TEXT        NOT NULL,
+    reason        TEXT        NOT NULL,
+    "rawData"     TEXT        NOT NULL,
+    "createdAt"   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (txhash, "instIndex")
+);
+
+-- the ledger balances, escrowed listings excluded
+CREATE TABLE IF NOT EXISTS "Balance" (
+    tick        TEXT        NOT NULL,
+    address     TEXT        NOT NULL,
+    amount      BIGINT      NOT NULL,
+    "updatedAt" TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (tick, address)
+);
+CREATE INDEX IF NOT EXISTS "Balance_tick_amount_idx" ON "Balance" (tick, amount DESC);
@@ -0,0 +1,12 @@
+-- the webhook payloads not delivered after all the attempts, see webhook.Notifier
+CREATE TABLE IF NOT EXISTS "WebhookDeadLetter" (
+    id             BIGSERIAL PRIMARY KEY,
+    subscription   TEXT        NOT NULL,
+    url            TEXT        NOT NULL,
+    delivery       TEXT        NOT NULL,
+    payload        JSONB       NOT NULL,
+    attempts       INTEGER     NOT NULL,
+    error          TEXT        NOT NULL,
+    "createdAt"    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS "WebhookDeadLetter_subscription_idx" ON "WebhookDeadLetter" (subscription, "createdAt");
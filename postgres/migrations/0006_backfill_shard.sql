@@ -0,0 +1,29 @@
+-- the slot ranges of the sharded backfill jobs, leased by the workers, see postgres.Shards
+CREATE TABLE IF NOT EXISTS "BackfillShard" (
+    job           TEXT        NOT NULL,
+    "fromSlot"    BIGINT      NOT NULL,
+    "toSlot"      BIGINT      NOT NULL,
+    slot          BIGINT      NOT NULL, -- the last slot fetched
+    done          BOOLEAN     NOT NULL DEFAULT false,
+    owner         TEXT,
+    "leasedUntil" TIMESTAMPTZ,
+    "updatedAt"   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (job, "fromSlot")
+);
+
+-- the operations found by the shards, checked by the ledger once the job is applied in slot order
+CREATE TABLE IF NOT EXISTS "BackfillOperation" (
+    job           TEXT    NOT NULL,
+    slot          BIGINT  NOT NULL,
+    "blockHeight" BIGINT  NOT NULL,
+    timestamp     BIGINT  NOT NULL,
+    "txIndex"     INTEGER NOT NULL,
+    "instIndex"   INTEGER NOT NULL,
+    txhash        TEXT    NOT NULL,
+    "from"        TEXT    NOT NULL,
+    "to"          TEXT    NOT NULL,
+    value         TEXT    NOT NULL,
+    "rawData"     TEXT    NOT NULL,
+    PRIMARY KEY (job, txhash, "instIndex")
+);
+CREATE INDEX IF NOT EXISTS "BackfillOperation_job_slot_idx" ON "BackfillOperation" (job, slot, "txIndex", "instIndex");
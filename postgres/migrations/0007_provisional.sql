@@ -0,0 +1,9 @@
+-- the slot of the operations, 0 for the ones stored before, and whether its
+-- block is only confirmed, see sink.Finality
+ALTER TABLE "Operation" ADD COLUMN IF NOT EXISTS slot BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE "Operation" ADD COLUMN IF NOT EXISTS provisional BOOLEAN NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS "Operation_provisional_slot_idx" ON "Operation" (slot) WHERE provisional;
+
+ALTER TABLE "Rejection" ADD COLUMN IF NOT EXISTS slot BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE "Rejection" ADD COLUMN IF NOT EXISTS provisional BOOLEAN NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS "Rejection_provisional_slot_idx" ON "Rejection" (slot) WHERE provisional;
@@ -0,0 +1,3 @@
+-- the API pages the operations in chain order, the row ids don't follow it
+-- once a backfill inserts older operations
+CREATE INDEX IF NOT EXISTS "Operation_blockHeight_txIndex_instIndex_idx" ON "Operation" ("blockHeight", "txIndex", "instIndex");
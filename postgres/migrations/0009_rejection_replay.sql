@@ -0,0 +1,5 @@
+-- the fields a merge needs to check the rejected operations again, the ones
+-- stored before are merged without a recipient and a value
+ALTER TABLE "Rejection" ADD COLUMN IF NOT EXISTS "to" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "Rejection" ADD COLUMN IF NOT EXISTS value TEXT NOT NULL DEFAULT '0x0';
+ALTER TABLE "Rejection" ADD COLUMN IF NOT EXISTS timestamp BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+-- the newest signature the signatures ingestion scanned of each account, the
+-- next scan pages back to it
+CREATE TABLE IF NOT EXISTS "SignatureCursor" (
+    account     TEXT        PRIMARY KEY,
+    signature   TEXT        NOT NULL,
+    slot        BIGINT      NOT NULL,
+    "updatedAt" TIMESTAMPTZ NOT NULL DEFAULT now()
+);
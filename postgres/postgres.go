@@ -3,116 +3,273 @@ package postgres
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
-	"github.com/lib/pq"
+	"github.com/holiman/uint256"
+	_ "github.com/lib/pq"
 	"go.uber.org/zap"
 
-	"sol_block_extractord/common"
 	"sol_block_extractord/config"
-	"sol_block_extractord/filters"
 	"sol_block_extractord/log"
+	"sol_block_extractord/metrics"
+	"sol_block_extractord/sink"
 	"sol_block_extractord/types"
 )
 
-type Api interface {
-	PostOperation(op types.Operation) error
+// Cli is the postgres sink.
+type Cli struct {
+	db *sql.DB
 }
 
-type Cli struct {
-	db   *sql.DB
-	stmt *sql.Stmt
+var _ sink.Sink = (*Cli)(nil)
+
+func open() (db *sql.DB, err error) {
+	dataSource, err := config.Cfg.Pg.DataSource()
+	if err != nil {
+		return
+	}
+
+	log.Logger.Debug("dataSource", zap.String("ds", config.Cfg.Pg.Redacted()))
+	db, err = sql.Open("postgres", dataSource)
+	if err != nil {
+		log.Logger.Error("connect postgres server failed", zap.Error(err))
+	}
+	return
 }
 
-func NewCli() (cli Cli, err error) {
-	dataSource := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		config.Cfg.Pg.Host,
-		config.Cfg.Pg.Port,
-		config.Cfg.Pg.User,
-		config.Cfg.Pg.Password,
-		config.Cfg.Pg.DbName)
-
-	log.Logger.Debug("dataSource", zap.String("ds", dataSource))
-	db, err := sql.Open("postgres", dataSource)
+func NewCli() (cli *Cli, err error) {
+	db, err := open()
 	if err != nil {
-		log.Logger.Error("connect postgres server failed", zap.String("err", err.Error()))
 		return
 	}
 
-	stmt, err := db.Prepare(
-		"INSERT INTO \"Operation\"(\"from\", \"to\", txhash, \"rawData\", \"blockHeight\", p, op, tick, amt, lim, max, \"createdAt\",\"updatedAt\", value, timestamp, \"txIndex\") VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,now(),now(),$12,$13,$14) RETURNING id")
+	err = db.Ping()
 	if err != nil {
-		log.Logger.Error("postgres prepare failed", zap.String("err", err.Error()))
+		log.Logger.Error("postgres ping failed", zap.Error(err))
+		db.Close()
 		return
 	}
 
-	return Cli{db: db, stmt: stmt}, nil
+	return &Cli{db: db}, nil
 }
 
-const maxRetry = 3
+const (
+	maxRetry = 3
 
-func (cli *Cli) PostOperation(op types.Operation) (err error) {
+	operationColumns = 17
+	rowsPerInsert    = 1000 // keeps an INSERT under the 65535 parameters limit
+)
+
+// insertOperationsQuery inserts ops in one statement, the rows conflicting
+// with a unique constraint are skipped and the inserted ones returned.
+func insertOperationsQuery(ops []types.Operation) (query string, args []interface{}) {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO \"Operation\"(\"from\", \"to\", txhash, \"rawData\", \"blockHeight\", p, op, tick, amt, lim, max, \"createdAt\",\"updatedAt\", value, timestamp, \"txIndex\", \"instIndex\", slot, provisional) VALUES")
+
+	args = make([]interface{}, 0, len(ops)*operationColumns)
+	for i, op := range ops {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		n := i * operationColumns
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,now(),now(),$%d,$%d,$%d,$%d,$%d,$%d)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11, n+12, n+13, n+14, n+15, n+16, n+17)
+		args = append(args, op.From, op.To, op.TxHash, op.MemoRaw, op.BlockHeightStr, op.M.P, op.M.Op, op.M.Tick, op.M.Amt, op.M.Lim, op.M.Max, op.Value.String(), op.BlockTimeSecStr, op.TxIdx, op.InstIdx, op.Slot, op.Provisional)
+	}
+	sb.WriteString(" ON CONFLICT DO NOTHING RETURNING txhash")
+
+	return sb.String(), args
+}
+
+// Write stores b in one transaction, the operations already written are
+// skipped like duplicated txIds always were.
+func (cli *Cli) Write(b sink.Batch) (err error) {
 	retry := 0
 	var start, end time.Time
+	var inserted map[string]bool
 	for {
 		start = time.Now()
-		_, err = cli.stmt.Exec(op.From, op.To, op.TxHash, op.MemoRaw, op.BlockHeightStr, op.M.P, op.M.Op, op.M.Tick, op.M.Amt, op.M.Lim, op.M.Max, op.Value.String(), op.BlockTimeSecStr, op.TxIdx)
+		inserted, err = cli.insertBatch(b)
 		end = time.Now()
-		if err != nil {
-			if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" { //unique constrain
-				log.Logger.Info("duplicated txId", zap.String("txId", op.TxHash))
-				return nil
-			} else {
-				retry = retry + 1
-				if retry > maxRetry {
-					log.Logger.Warn("reach max retry", zap.String("operation", fmt.Sprintf("%v", op)), zap.String("err", err.Error()))
-					break
-				}
-				time.Sleep(time.Second * 2)
-			}
-		} else {
-			log.Logger.Info(fmt.Sprintf("exec sql elapse %v", end.Sub(start).Milliseconds()))
+		metrics.InsertSeconds.Observe(end.Sub(start).Seconds())
+		if err == nil {
 			break
 		}
+
+		retry = retry + 1
+		if retry > maxRetry {
+			log.Logger.Warn("reach max retry", zap.Int("operations", len(b.Ops)), zap.Error(err))
+			return err
+		}
+		metrics.InsertRetries.Inc()
+		time.Sleep(time.Second * 2)
 	}
 
-	return err
+	for _, op := range b.Ops {
+		if !inserted[op.TxHash] {
+			log.Logger.Info("duplicated operation skipped", zap.Uint64("slot", op.Slot), zap.Uint64("block_height", op.BlockHeight), zap.Int("txIndex", op.TxIdx), zap.String("signature", op.TxHash))
+		}
+	}
+	log.Logger.Info("batch written", zap.Int("operations", len(b.Ops)), zap.Int("rejections", len(b.Rejections)), zap.Duration("elapsed", end.Sub(start)))
+
+	return nil
 }
 
-func PostOperations(operationCh chan types.Operation) {
-	deployed := config.Cfg.Biz.DeployHeight != 0
-	cli, err := NewCli()
+func (cli *Cli) insertBatch(b sink.Batch) (inserted map[string]bool, err error) {
+	tx, err := cli.db.Begin()
 	if err != nil {
-		log.Logger.Fatal(fmt.Sprintf("pg NewCli err:%v", err))
+		return
+	}
+	defer tx.Rollback()
+
+	if b.Rollback {
+		for _, table := range []string{"Operation", "Rejection"} {
+			_, err = tx.Exec("DELETE FROM \""+table+"\" WHERE provisional AND slot >= $1", b.RollbackFrom)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if b.Replace {
+		for _, table := range []string{"Operation", "Rejection"} {
+			_, err = tx.Exec("DELETE FROM \""+table+"\" WHERE NOT provisional AND tick = $1", config.Cfg.Biz.Ins.Tick)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	inserted = make(map[string]bool, len(b.Ops))
+	for i := 0; i < len(b.Ops); i += rowsPerInsert {
+		end := i + rowsPerInsert
+		if end > len(b.Ops) {
+			end = len(b.Ops)
+		}
+
+		query, args := insertOperationsQuery(b.Ops[i:end])
+		rows, err := tx.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var txHash string
+			if err = rows.Scan(&txHash); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			inserted[txHash] = true
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
 	}
 
-	for operation := range operationCh {
-		txCoordinate := common.TxCoordinate(operation.BlockHeight, operation.TxIdx, operation.TxHash)
-		log.Logger.Info(fmt.Sprintf("operation begin: %s", operation.ToString()))
+	for _, r := range b.Rejections {
+		_, err = tx.Exec("INSERT INTO \"Rejection\"(txhash, \"instIndex\", \"blockHeight\", \"txIndex\", \"from\", \"to\", op, tick, reason, \"rawData\", value, timestamp, slot, provisional, \"createdAt\") VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, now()) ON CONFLICT DO NOTHING",
+			r.Op.TxHash, r.Op.InstIdx, r.Op.BlockHeight, r.Op.TxIdx, r.Op.From, r.Op.To, r.Op.M.Op, r.Op.M.Tick, r.Reason, r.Op.MemoRaw, r.Op.Value.String(), r.Op.BlockTimeSec, r.Op.Slot, r.Op.Provisional)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		pass, reason := filters.FilterOperation(operation)
-		if !pass {
-			log.Logger.Error(fmt.Sprintf("%s filtered with reason: [%s]", txCoordinate, reason))
-			continue
+	if b.AllBalances {
+		_, err = tx.Exec("DELETE FROM \"Balance\" WHERE tick = $1", config.Cfg.Biz.Ins.Tick)
+		if err != nil {
+			return nil, err
 		}
+	}
+	if err = writeBalances(tx, b.Balances); err != nil {
+		return nil, err
+	}
+
+	if b.Finalized != 0 {
+		for _, table := range []string{"Operation", "Rejection"} {
+			_, err = tx.Exec("UPDATE \""+table+"\" SET provisional = false WHERE provisional AND slot <= $1", b.Finalized)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
 
-		err = cli.PostOperation(operation)
+	return inserted, tx.Commit()
+}
+
+// writeBalances upserts the balances of the configured tick, removing the
+// zero ones.
+func writeBalances(tx *sql.Tx, balances map[string]int64) error {
+	tick := config.Cfg.Biz.Ins.Tick
+	for addr, amt := range balances {
+		var err error
+		if amt == 0 {
+			_, err = tx.Exec("DELETE FROM \"Balance\" WHERE tick = $1 AND address = $2", tick, addr)
+		} else {
+			_, err = tx.Exec("INSERT INTO \"Balance\"(tick, address, amount, \"updatedAt\") VALUES($1, $2, $3, now()) ON CONFLICT (tick, address) DO UPDATE SET amount = EXCLUDED.amount, \"updatedAt\" = now()",
+				tick, addr, amt)
+		}
 		if err != nil {
-			cli.Shutdown()
-			log.Logger.Fatal(fmt.Sprintf("!! %s do [operation ==> pg] failed with err:%s!!. begin shutdown", txCoordinate, err.Error()))
+			return err
 		}
+	}
+	return nil
+}
+
+// LoadOperations feeds the persisted operations to fn in (height, txIdx, instIdx) order.
+func (cli *Cli) LoadOperations(fn func(op types.Operation)) error {
+	rows, err := cli.db.Query("SELECT \"from\", \"to\", txhash, \"rawData\", \"blockHeight\", p, op, tick, amt, lim, max, value, timestamp, \"txIndex\", \"instIndex\", slot, provisional FROM \"Operation\" ORDER BY \"blockHeight\", \"txIndex\", \"instIndex\"")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var op types.Operation
+		var height uint64
+		var timeSec int64
+		var value string
+		err = rows.Scan(&op.From, &op.To, &op.TxHash, &op.MemoRaw, &height, &op.M.P, &op.M.Op, &op.M.Tick, &op.M.Amt, &op.M.Lim, &op.M.Max, &value, &timeSec, &op.TxIdx, &op.InstIdx, &op.Slot, &op.Provisional)
+		if err != nil {
+			return err
+		}
+
+		op.Restore(height, timeSec, value)
+		fn(op)
+	}
+
+	return rows.Err()
+}
 
-		if !deployed && operation.M.Op == types.OpDeploy {
-			config.Cfg.Biz.DeployHeight = operation.BlockHeight
-			deployed = true
+// LoadRejections feeds the persisted rejections to fn, only the op and tick
+// of their memo are stored, the rest is parsed again from the raw data.
+func (cli *Cli) LoadRejections(fn func(r sink.Rejection)) error {
+	rows, err := cli.db.Query("SELECT txhash, \"instIndex\", \"blockHeight\", \"txIndex\", \"from\", \"to\", op, tick, reason, \"rawData\", value, timestamp, slot, provisional FROM \"Rejection\"")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r sink.Rejection
+		var height uint64
+		var timeSec int64
+		var value string
+		err = rows.Scan(&r.Op.TxHash, &r.Op.InstIdx, &height, &r.Op.TxIdx, &r.Op.From, &r.Op.To, &r.Op.M.Op, &r.Op.M.Tick, &r.Reason, &r.Op.MemoRaw, &value, &timeSec, &r.Op.Slot, &r.Op.Provisional)
+		if err != nil {
+			return err
 		}
 
-		log.Logger.Info(fmt.Sprintf("*****%s succeed****", txCoordinate))
+		if m, err := types.ParseMemo(r.Op.MemoRaw); err == nil {
+			r.Op.M = m
+		}
+		r.Op.SetupBlockInfo(height, timeSec, r.Op.TxIdx)
+		r.Op.Value, _ = uint256.FromHex(value)
+		fn(r)
 	}
+
+	return rows.Err()
 }
 
-func (cli *Cli) Shutdown() {
-	cli.stmt.Close()
-	cli.db.Close()
+func (cli *Cli) Close() error {
+	return cli.db.Close()
 }
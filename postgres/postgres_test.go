@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	"sol_block_extractord/types"
+)
+
+func TestInsertOperationsQuery(t *testing.T) {
+	ops := make([]types.Operation, 3)
+	for i := range ops {
+		ops[i] = types.Operation{TxHash: string(rune('a' + i)), TxIdx: i, InstIdx: 1, Value: uint256.NewInt(uint64(i)), Slot: 105, Provisional: i == 2}
+		ops[i].SetupBlockInfo(100, 1700000000, i)
+	}
+
+	query, args := insertOperationsQuery(ops)
+	require.Len(t, args, len(ops)*operationColumns)
+	require.Equal(t, len(ops), strings.Count(query, "now(),now()"))
+	require.Contains(t, query, "($35,$36,$37,$38,$39,$40,$41,$42,$43,$44,$45,now(),now(),$46,$47,$48,$49,$50,$51)")
+	require.True(t, strings.HasSuffix(query, " ON CONFLICT DO NOTHING RETURNING txhash"))
+	require.Equal(t, "c", args[2*operationColumns+2])
+	require.Equal(t, "0x2", args[2*operationColumns+11])
+	require.Equal(t, 2, args[3*operationColumns-4])
+	require.Equal(t, 1, args[3*operationColumns-3])
+	require.Equal(t, uint64(105), args[3*operationColumns-2])
+	require.Equal(t, true, args[3*operationColumns-1])
+}
@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"sol_block_extractord/finished_block_manager"
+	"sol_block_extractord/log"
+)
+
+// ProgressTracker keeps the finished slot in memory and persists the
+// checkpoints in the "Progress" table under name, so a restart resumes from
+// the last slot whose operations were stored.
+type ProgressTracker struct {
+	*finished_block_manager.MemoryTracker
+	db   *sql.DB
+	name string
+}
+
+func NewProgressTracker(name string, startBlock uint64) (tracker *ProgressTracker, err error) {
+	db, err := open()
+	if err != nil {
+		return
+	}
+
+	tracker = &ProgressTracker{
+		MemoryTracker: finished_block_manager.NewMemoryTracker(startBlock),
+		db:            db,
+		name:          name,
+	}
+
+	var stored uint64
+	err = db.QueryRow("SELECT slot FROM \"Progress\" WHERE name = $1", name).Scan(&stored)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tracker, nil
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if stored > tracker.Get() {
+		log.Logger.Info("progress resumes from the stored slot", zap.String("progress", name), zap.Uint64("slot", stored))
+		tracker.MemoryTracker.Update(stored)
+	}
+	return tracker, nil
+}
+
+// Checkpoint persists slot once the operations up to it are stored, the
+// in-memory finished slot runs ahead of it.
+func (t *ProgressTracker) Checkpoint(slot uint64) {
+	_, err := t.db.Exec(
+		"INSERT INTO \"Progress\"(name, slot, \"updatedAt\") VALUES($1, $2, now()) ON CONFLICT (name) DO UPDATE SET slot = EXCLUDED.slot, \"updatedAt\" = now() WHERE \"Progress\".slot < EXCLUDED.slot",
+		t.name, slot)
+	if err != nil {
+		log.Logger.Warn("persist progress failed", zap.String("progress", t.name), zap.Uint64("slot", slot), zap.Error(err))
+	}
+}
+
+func (t *ProgressTracker) Shutdown() {
+	t.db.Close()
+}
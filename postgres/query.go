@@ -0,0 +1,220 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"sol_block_extractord/types"
+)
+
+const operationSelect = "SELECT id, \"from\", \"to\", txhash, \"instIndex\", \"rawData\", \"blockHeight\", p, op, tick, amt, lim, max, value, timestamp, \"txIndex\", provisional FROM \"Operation\""
+
+// chainOrder sorts the operations as they are on chain, the row ids don't:
+// a backfill or a shard inserts older operations after the newer ones.
+const chainOrder = "\"blockHeight\", \"txIndex\", \"instIndex\""
+
+// StoredOperation is an operation with its row id.
+type StoredOperation struct {
+	ID int64
+	types.Operation
+}
+
+// Cursor is the chain position of an operation, the pagination cursor.
+type Cursor struct {
+	BlockHeight uint64
+	TxIdx       int
+	InstIdx     int
+}
+
+func (op *StoredOperation) Cursor() Cursor {
+	return Cursor{BlockHeight: op.BlockHeight, TxIdx: op.TxIdx, InstIdx: op.InstIdx}
+}
+
+// String is the cursor as blockHeight-txIndex-instIndex.
+func (c Cursor) String() string {
+	return fmt.Sprintf("%d-%d-%d", c.BlockHeight, c.TxIdx, c.InstIdx)
+}
+
+func ParseCursor(s string) (c Cursor, err error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 3 {
+		return c, fmt.Errorf("cursor %q not blockHeight-txIndex-instIndex", s)
+	}
+	c.BlockHeight, err = strconv.ParseUint(parts[0], 10, 64)
+	if err == nil {
+		c.TxIdx, err = strconv.Atoi(parts[1])
+	}
+	if err == nil {
+		c.InstIdx, err = strconv.Atoi(parts[2])
+	}
+	if err != nil || c.TxIdx < 0 || c.InstIdx < 0 {
+		return Cursor{}, fmt.Errorf("cursor %q not blockHeight-txIndex-instIndex", s)
+	}
+	return c, nil
+}
+
+type OperationFilter struct {
+	Address string // from or to
+	Tick    string
+	Op      string
+	Cursor  *Cursor // of the last operation of the previous page, nil for the first page
+	Limit   int
+}
+
+type TickInfo struct {
+	Tick    string
+	Deploy  *StoredOperation // nil until deployed
+	Minted  int64
+	Burned  int64
+	Holders int
+}
+
+type Balance struct {
+	Tick   string
+	Amount int64
+}
+
+// Query reads the indexed data for the API.
+type Query struct {
+	db *sql.DB
+}
+
+func NewQuery() (*Query, error) {
+	db, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return &Query{db: db}, nil
+}
+
+func (q *Query) Ping(ctx context.Context) error {
+	return q.db.PingContext(ctx)
+}
+
+func scanOperations(rows *sql.Rows) (ops []StoredOperation, err error) {
+	defer rows.Close()
+	for rows.Next() {
+		var op StoredOperation
+		var height uint64
+		var timeSec int64
+		var value string
+		err = rows.Scan(&op.ID, &op.From, &op.To, &op.TxHash, &op.InstIdx, &op.MemoRaw, &height, &op.M.P, &op.M.Op, &op.M.Tick, &op.M.Amt, &op.M.Lim, &op.M.Max, &value, &timeSec, &op.TxIdx, &op.Provisional)
+		if err != nil {
+			return
+		}
+		op.Restore(height, timeSec, value)
+		ops = append(ops, op)
+	}
+	return ops, rows.Err()
+}
+
+// OperationsBySignature are the operations of a transaction, one per memo
+// instruction.
+func (q *Query) OperationsBySignature(signature string) ([]StoredOperation, error) {
+	rows, err := q.db.Query(operationSelect+" WHERE txhash = $1 ORDER BY \"instIndex\"", signature)
+	if err != nil {
+		return nil, err
+	}
+	return scanOperations(rows)
+}
+
+// Operations are the operations matching f, the latest on chain first.
+func (q *Query) Operations(f OperationFilter) ([]StoredOperation, error) {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.Address != "" {
+		p := arg(f.Address)
+		where = append(where, fmt.Sprintf("(\"from\" = %s OR \"to\" = %s)", p, p))
+	}
+	if f.Tick != "" {
+		where = append(where, "tick = "+arg(f.Tick))
+	}
+	if f.Op != "" {
+		where = append(where, "op = "+arg(f.Op))
+	}
+	if f.Cursor != nil {
+		where = append(where, fmt.Sprintf("(%s) < (%s, %s, %s)", chainOrder, arg(f.Cursor.BlockHeight), arg(f.Cursor.TxIdx), arg(f.Cursor.InstIdx)))
+	}
+
+	query := operationSelect
+	if len(where) != 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY \"blockHeight\" DESC, \"txIndex\" DESC, \"instIndex\" DESC LIMIT " + arg(f.Limit)
+
+	rows, err := q.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanOperations(rows)
+}
+
+func (q *Query) Tick(tick string) (info TickInfo, err error) {
+	info.Tick = tick
+
+	rows, err := q.db.Query(operationSelect+" WHERE tick = $1 AND op = 'deploy' ORDER BY "+chainOrder+" LIMIT 1", tick)
+	if err != nil {
+		return
+	}
+	deploys, err := scanOperations(rows)
+	if err != nil {
+		return
+	}
+	if len(deploys) != 0 {
+		info.Deploy = &deploys[0]
+	}
+
+	err = q.db.QueryRow("SELECT COALESCE(SUM(amt::BIGINT) FILTER (WHERE op = 'mint'), 0), COALESCE(SUM(amt::BIGINT) FILTER (WHERE op = 'burn'), 0) FROM \"Operation\" WHERE tick = $1 AND op IN ('mint', 'burn')", tick).
+		Scan(&info.Minted, &info.Burned)
+	if err != nil {
+		return
+	}
+	err = q.db.QueryRow("SELECT COUNT(*) FROM \"Balance\" WHERE tick = $1", tick).Scan(&info.Holders)
+	return
+}
+
+func (q *Query) Balances(address string) (balances []Balance, err error) {
+	rows, err := q.db.Query("SELECT tick, amount FROM \"Balance\" WHERE address = $1 ORDER BY tick", address)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b Balance
+		if err = rows.Scan(&b.Tick, &b.Amount); err != nil {
+			return
+		}
+		balances = append(balances, b)
+	}
+	return balances, rows.Err()
+}
+
+// Progress is the checkpointed slot of the indexing process name, 0 when it
+// hasn't checkpointed yet.
+func (q *Query) Progress(name string) (slot uint64, err error) {
+	err = q.db.QueryRow("SELECT slot FROM \"Progress\" WHERE name = $1", name).Scan(&slot)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return
+}
+
+// LastSlot is the slot of the latest final operation stored, 0 when none is.
+func (q *Query) LastSlot() (slot uint64, err error) {
+	err = q.db.QueryRow("SELECT COALESCE(MAX(slot), 0) FROM \"Operation\" WHERE NOT provisional").Scan(&slot)
+	return
+}
+
+func (q *Query) Shutdown() {
+	q.db.Close()
+}
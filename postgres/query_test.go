@@ -0,0 +1,19 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor(t *testing.T) {
+	c := Cursor{BlockHeight: 250000000, TxIdx: 12, InstIdx: 1}
+	parsed, err := ParseCursor(c.String())
+	require.NoError(t, err)
+	require.Equal(t, c, parsed)
+
+	for _, s := range []string{"", "42", "1-2", "1-2-3-4", "a-1-0", "1--1-0"} {
+		_, err = ParseCursor(s)
+		require.Error(t, err, s)
+	}
+}
@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"sol_block_extractord/config"
+)
+
+// RulesLog records the business rules versions in the "RulesVersion" table,
+// so a replay applies the same rules at the same slots.
+type RulesLog struct {
+	db *sql.DB
+}
+
+func NewRulesLog() (*RulesLog, error) {
+	db, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return &RulesLog{db: db}, nil
+}
+
+func (l *RulesLog) Load() (versions []config.RulesVersion, err error) {
+	rows, err := l.db.Query("SELECT slot, rules FROM \"RulesVersion\" ORDER BY slot")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v config.RulesVersion
+		var rules []byte
+		err = rows.Scan(&v.From, &rules)
+		if err != nil {
+			return
+		}
+		err = json.Unmarshal(rules, &v.Rules)
+		if err != nil {
+			return
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+// Record stores v, dropping the versions it supersedes like config.ScheduleRules.
+func (l *RulesLog) Record(v config.RulesVersion) error {
+	rules, err := json.Marshal(v.Rules)
+	if err != nil {
+		return err
+	}
+
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM \"RulesVersion\" WHERE slot >= $1", v.From)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO \"RulesVersion\"(slot, rules, \"createdAt\") VALUES($1, $2, now())", v.From, rules)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (l *RulesLog) Shutdown() {
+	l.db.Close()
+}
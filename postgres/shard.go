@@ -0,0 +1,199 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/holiman/uint256"
+
+	"sol_block_extractord/types"
+)
+
+// ErrLeaseLost means another worker took the shard over, its lease having
+// expired.
+var ErrLeaseLost = errors.New("shard lease lost")
+
+// Shard is a slot range of a backfill job.
+type Shard struct {
+	Job  string
+	From uint64
+	To   uint64
+	Slot uint64 // the last slot fetched
+}
+
+// splitShards splits [from, to] in ranges of size slots, the last one may be
+// shorter.
+func splitShards(job string, from, to, size uint64) (shards []Shard) {
+	for start := from; start <= to; start += size {
+		end := to
+		if to-start >= size {
+			end = start + size - 1
+		}
+		shards = append(shards, Shard{Job: job, From: start, To: end, Slot: start - 1})
+		if end == to {
+			break
+		}
+	}
+	return
+}
+
+// Shards are the backfill jobs in the "BackfillShard" table. A worker leases
+// a shard for the lease duration, renewed by Heartbeat, and stores the
+// operations it finds in "BackfillOperation" along with the shard progress,
+// so the shard of a worker gone is resumed by another one once its lease
+// expires.
+type Shards struct {
+	db    *sql.DB
+	owner string
+	lease time.Duration
+}
+
+func NewShards(owner string, lease time.Duration) (*Shards, error) {
+	db, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return &Shards{db: db, owner: owner, lease: lease}, nil
+}
+
+// Create splits [from, to] of job in shards of size slots and returns how
+// many were added, creating a job again adds none.
+func (s *Shards) Create(job string, from, to, size uint64) (created int, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	for _, shard := range splitShards(job, from, to, size) {
+		res, err := tx.Exec("INSERT INTO \"BackfillShard\"(job, \"fromSlot\", \"toSlot\", slot, \"updatedAt\") VALUES($1, $2, $3, $4, now()) ON CONFLICT DO NOTHING",
+			job, shard.From, shard.To, shard.Slot)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := res.RowsAffected()
+		created += int(n)
+	}
+	return created, tx.Commit()
+}
+
+// Lease takes the first shard of job neither done nor leased, nil when none.
+func (s *Shards) Lease(job string) (*Shard, error) {
+	shard := Shard{Job: job}
+	err := s.db.QueryRow(
+		"UPDATE \"BackfillShard\" SET owner = $2, \"leasedUntil\" = now() + $3 * interval '1 second', \"updatedAt\" = now() WHERE (job, \"fromSlot\") = "+
+			"(SELECT job, \"fromSlot\" FROM \"BackfillShard\" WHERE job = $1 AND NOT done AND (\"leasedUntil\" IS NULL OR \"leasedUntil\" < now()) ORDER BY \"fromSlot\" LIMIT 1 FOR UPDATE SKIP LOCKED) "+
+			"RETURNING \"fromSlot\", \"toSlot\", slot",
+		job, s.owner, s.lease.Seconds()).Scan(&shard.From, &shard.To, &shard.Slot)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &shard, nil
+}
+
+// Heartbeat renews the lease of shard.
+func (s *Shards) Heartbeat(shard *Shard) error {
+	return s.exec(s.db, "UPDATE \"BackfillShard\" SET \"leasedUntil\" = now() + $4 * interval '1 second', \"updatedAt\" = now() WHERE job = $1 AND \"fromSlot\" = $2 AND owner = $3 AND NOT done",
+		shard.Job, shard.From, s.owner, s.lease.Seconds())
+}
+
+// Write stores ops and moves the progress of shard to slot in one
+// transaction, the operations already stored are skipped.
+func (s *Shards) Write(shard *Shard, slot uint64, ops []types.Operation) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, op := range ops {
+		_, err = tx.Exec("INSERT INTO \"BackfillOperation\"(job, slot, \"blockHeight\", timestamp, \"txIndex\", \"instIndex\", txhash, \"from\", \"to\", value, \"rawData\") VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) ON CONFLICT DO NOTHING",
+			shard.Job, op.Slot, op.BlockHeight, op.BlockTimeSec, op.TxIdx, op.InstIdx, op.TxHash, op.From, op.To, op.Value.String(), op.MemoRaw)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.exec(tx, "UPDATE \"BackfillShard\" SET slot = $4, \"updatedAt\" = now() WHERE job = $1 AND \"fromSlot\" = $2 AND owner = $3 AND NOT done",
+		shard.Job, shard.From, s.owner, slot)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	shard.Slot = slot
+	return nil
+}
+
+// Complete marks shard done and releases it.
+func (s *Shards) Complete(shard *Shard) error {
+	err := s.exec(s.db, "UPDATE \"BackfillShard\" SET done = true, slot = \"toSlot\", owner = NULL, \"leasedUntil\" = NULL, \"updatedAt\" = now() WHERE job = $1 AND \"fromSlot\" = $2 AND owner = $3 AND NOT done",
+		shard.Job, shard.From, s.owner)
+	if err == nil {
+		shard.Slot = shard.To
+	}
+	return err
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// exec runs an update of a shard owned by this worker, ErrLeaseLost when it
+// isn't anymore.
+func (s *Shards) exec(e execer, query string, args ...interface{}) error {
+	res, err := e.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Remaining is the number of shards of job not done yet, leased or not.
+func (s *Shards) Remaining(job string) (remaining int, err error) {
+	err = s.db.QueryRow("SELECT count(*) FROM \"BackfillShard\" WHERE job = $1 AND NOT done", job).Scan(&remaining)
+	return
+}
+
+// LoadOperations feeds the operations found by the shards of job to fn in
+// (slot, txIdx, instIdx) order.
+func (s *Shards) LoadOperations(job string, fn func(op types.Operation)) error {
+	rows, err := s.db.Query("SELECT slot, \"blockHeight\", timestamp, \"txIndex\", \"instIndex\", txhash, \"from\", \"to\", value, \"rawData\" FROM \"BackfillOperation\" WHERE job = $1 ORDER BY slot, \"txIndex\", \"instIndex\"", job)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var op types.Operation
+		var height uint64
+		var timeSec int64
+		var value string
+		err = rows.Scan(&op.Slot, &height, &timeSec, &op.TxIdx, &op.InstIdx, &op.TxHash, &op.From, &op.To, &value, &op.MemoRaw)
+		if err != nil {
+			return err
+		}
+
+		op.M, err = types.ParseMemo(op.MemoRaw)
+		if err != nil {
+			return err
+		}
+		op.SetupBlockInfo(height, timeSec, op.TxIdx)
+		op.Value, _ = uint256.FromHex(value)
+		fn(op)
+	}
+
+	return rows.Err()
+}
+
+func (s *Shards) Shutdown() {
+	s.db.Close()
+}
@@ -0,0 +1,18 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitShards(t *testing.T) {
+	require.Equal(t, []Shard{
+		{Job: "j", From: 10, To: 19, Slot: 9},
+		{Job: "j", From: 20, To: 29, Slot: 19},
+		{Job: "j", From: 30, To: 32, Slot: 29},
+	}, splitShards("j", 10, 32, 10))
+
+	require.Equal(t, []Shard{{Job: "j", From: 10, To: 19, Slot: 9}, {Job: "j", From: 20, To: 29, Slot: 19}}, splitShards("j", 10, 29, 10))
+	require.Equal(t, []Shard{{Job: "j", From: 5, To: 5, Slot: 4}}, splitShards("j", 5, 5, 10))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"sol_block_extractord/config"
+	"sol_block_extractord/finished_block_manager"
+	"sol_block_extractord/log"
+	"sol_block_extractord/postgres"
+)
+
+// fileCfg is the config as read from the --config file, before flags and
+// environment variables are layered on top.
+var fileCfg config.Config
+
+// setupRules schedules the recorded rules versions, and records the startup
+// rules when they differ from the ones recorded for startSlot.
+func setupRules(rulesLog *postgres.RulesLog, startSlot uint64) error {
+	if err := loadRules(rulesLog); err != nil {
+		return err
+	}
+
+	rules := config.Cfg.Biz.Rules()
+	if config.BizAt(startSlot).Rules() == rules {
+		return nil
+	}
+
+	log.Logger.Info("business rules differ from the recorded ones", zap.Uint64("slot", startSlot), zap.Any("rules", rules))
+	config.ScheduleRules(startSlot, rules)
+	return rulesLog.Record(config.RulesVersion{From: startSlot, Rules: rules})
+}
+
+// loadRules schedules the recorded rules versions.
+func loadRules(rulesLog *postgres.RulesLog) error {
+	versions, err := rulesLog.Load()
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		config.ScheduleRules(v.From, v.Rules)
+	}
+	return nil
+}
+
+// watchRules reloads the business rules from the config file on SIGHUP or
+// when the file changes. rulesLog may be nil.
+func watchRules(ctx context.Context, path string, tracker finished_block_manager.ProgressTracker, rulesLog *postgres.RulesLog) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(time.Second * 5)
+	defer ticker.Stop()
+
+	modTime := fileModTime(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Logger.Info("SIGHUP received, reload business rules")
+		case <-ticker.C:
+			t := fileModTime(path)
+			if t.Equal(modTime) {
+				continue
+			}
+			modTime = t
+			log.Logger.Info("config changed, reload business rules", zap.String("path", path))
+		}
+
+		err := reloadRules(path, tracker, rulesLog)
+		if err != nil {
+			log.Logger.Warn("reload business rules failed, keep the current ones", zap.Error(err))
+		}
+	}
+}
+
+func reloadRules(path string, tracker finished_block_manager.ProgressTracker, rulesLog *postgres.RulesLog) error {
+	next := fileCfg
+	next.Biz.EffectiveSlot = 0
+	if err := config.DecodeFile(path, &next); err != nil {
+		return err
+	}
+
+	if next.Biz.DeployHeight != fileCfg.Biz.DeployHeight || next.Biz.FreeMint != fileCfg.Biz.FreeMint || !reflect.DeepEqual(next.Biz.Ins, fileCfg.Biz.Ins) {
+		log.Logger.Warn("deployHeight, freeMint and inscription can't be reloaded, restart to apply them")
+	}
+
+	cur := config.LatestRules()
+	rules := config.MergeRules(cur, fileCfg.Biz.Rules(), next.Biz.Rules())
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+	fileCfg = next
+
+	if rules == cur {
+		log.Logger.Info("business rules unchanged")
+		return nil
+	}
+
+	// the slots after the finished one may have been checked already
+	from := next.Biz.EffectiveSlot
+	if finished := tracker.Get(); from <= finished {
+		from = finished + 1
+	}
+	from = config.RescheduleRules(from, rules)
+	log.Logger.Info("business rules reloaded", zap.Uint64("slot", from), zap.Any("rules", rules))
+
+	if rulesLog != nil {
+		if err := rulesLog.Record(config.RulesVersion{From: from, Rules: rules}); err != nil {
+			log.Logger.Warn("record business rules failed, a replay won't reproduce them", zap.Uint64("slot", from), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+
+	"sol_block_extractord/config"
+	"sol_block_extractord/finished_block_manager"
+	"sol_block_extractord/log"
+	"sol_block_extractord/postgres"
+	"sol_block_extractord/sink"
+	"sol_block_extractord/types"
+)
+
+func createShards(c *cli.Context) error {
+	job, from, to, size := c.String("job"), c.Uint64("from_slot"), c.Uint64("to_slot"), c.Uint64("shard_size")
+	if from == 0 || from > to {
+		return fmt.Errorf("invalid slot range [%d, %d]", from, to)
+	}
+	if size == 0 {
+		return errors.New("shard_size must be positive")
+	}
+	if err := prepareSchema(c); err != nil {
+		return err
+	}
+
+	shards, err := postgres.NewShards("", 0)
+	if err != nil {
+		return err
+	}
+	defer shards.Shutdown()
+
+	created, err := shards.Create(job, from, to, size)
+	if err != nil {
+		return err
+	}
+	log.Logger.Info("shards created", zap.String("job", job), zap.Int("shards", created), zap.Uint64("from", from), zap.Uint64("to", to))
+	return nil
+}
+
+// workShards processes the shards of the job one after the other until none
+// is left or SIGINT or SIGTERM. It waits for the shards leased by the other
+// processes, to take them over if their lease expires.
+func workShards(c *cli.Context) error {
+	job, workers, lease := c.String("job"), c.Int("workers"), c.Duration("lease")
+	if workers <= 0 {
+		return fmt.Errorf("workers must be positive, got %d", workers)
+	}
+	if lease <= 0 {
+		return fmt.Errorf("lease must be positive, got %v", lease)
+	}
+	if err := prepareSchema(c); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	hostname, _ := os.Hostname()
+	shards, err := postgres.NewShards(fmt.Sprintf("%s-%d", hostname, os.Getpid()), lease)
+	if err != nil {
+		return err
+	}
+	defer shards.Shutdown()
+
+	rulesLog, err := postgres.NewRulesLog()
+	if err != nil {
+		return err
+	}
+	err = loadRules(rulesLog)
+	rulesLog.Shutdown()
+	if err != nil {
+		return err
+	}
+
+	for ctx.Err() == nil {
+		shard, err := shards.Lease(job)
+		if err != nil {
+			return err
+		}
+		if shard == nil {
+			remaining, err := shards.Remaining(job)
+			if err != nil {
+				return err
+			}
+			if remaining == 0 {
+				log.Logger.Info("no shard left", zap.String("job", job))
+				return nil
+			}
+			log.Logger.Info("shards leased by other processes, wait", zap.String("job", job), zap.Int("shards", remaining))
+			sleep(ctx, lease/2)
+			continue
+		}
+
+		logger := log.Logger.With(zap.String("job", job), zap.Uint64("from", shard.From), zap.Uint64("to", shard.To))
+		logger.Info("shard leased", zap.Uint64("slot", shard.Slot))
+		err = workShard(ctx, shards, shard, workers, lease)
+		if errors.Is(err, postgres.ErrLeaseLost) {
+			logger.Warn("shard lease lost, taken over by another process", zap.Uint64("slot", shard.Slot))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if ctx.Err() == nil {
+			logger.Info("shard done")
+		}
+	}
+	return nil
+}
+
+// workShard stores the operations of shard from its progress on, renewing
+// its lease meanwhile. It completes shard unless ctx is done first.
+func workShard(ctx context.Context, shards *postgres.Shards, shard *postgres.Shard, workers int, lease time.Duration) error {
+	shardCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	heartbeatDone := make(chan struct{})
+	var heartbeatErr error
+	go func() {
+		defer close(heartbeatDone)
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-shardCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := shards.Heartbeat(shard)
+			if errors.Is(err, postgres.ErrLeaseLost) {
+				heartbeatErr = err
+				cancel()
+				return
+			}
+			if err != nil {
+				log.Logger.Warn("shard heartbeat failed", zap.String("job", shard.Job), zap.Uint64("from", shard.From), zap.Error(err))
+			}
+		}
+	}()
+
+	tracker := finished_block_manager.NewMemoryTracker(shard.Slot + 1)
+	opsCh := make(chan sink.Block, 1000)
+	postDone := make(chan struct{})
+	var postErr error
+	go func() {
+		postErr = postShard(shards, shard, opsCh)
+		close(postDone)
+	}()
+
+	err := syncRange(shardCtx, newRPC(), shard.Slot+1, shard.To, workers, tracker, opsCh, postDone)
+
+	close(opsCh)
+	<-postDone
+	cancel()
+	<-heartbeatDone
+	if err == nil {
+		err = postErr
+	}
+	if err == nil {
+		err = heartbeatErr
+	}
+	if err != nil || ctx.Err() != nil {
+		return err
+	}
+	return shards.Complete(shard)
+}
+
+// postShard stores the operations of the blocks of shard until blockCh is
+// closed, with the shard progress, every Pg.BatchSize operations or
+// Pg.BatchInterval.
+func postShard(shards *postgres.Shards, shard *postgres.Shard, blockCh chan sink.Block) error {
+	var ops []types.Operation
+	var slot uint64
+	flush := func() error {
+		if slot <= shard.Slot {
+			return nil
+		}
+		err := shards.Write(shard, slot, ops)
+		ops = ops[:0]
+		return err
+	}
+
+	ticker := time.NewTicker(config.Cfg.Pg.BatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		case block, ok := <-blockCh:
+			if !ok {
+				return flush()
+			}
+			ops = append(ops, block.Ops...)
+			slot = block.Slot
+			if len(ops) >= config.Cfg.Pg.BatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// applyShards merges the operations stored by the shards of the job into the
+// ledger once they're all done, the whole ledger is checked again with them
+// in chain order, see sink.Merge, so it can be run again. start mustn't run
+// meanwhile, the ledger lock is refused while it holds it.
+func applyShards(c *cli.Context) error {
+	job := c.String("job")
+	if err := prepareSchema(c); err != nil {
+		return err
+	}
+	lock, err := postgres.LockLedger()
+	if err != nil {
+		return fmt.Errorf("lock the ledger err:%w, stop start before applying the shards", err)
+	}
+	defer lock.Unlock()
+
+	shards, err := postgres.NewShards("", 0)
+	if err != nil {
+		return err
+	}
+	defer shards.Shutdown()
+
+	remaining, err := shards.Remaining(job)
+	if err != nil {
+		return err
+	}
+	if remaining != 0 {
+		return fmt.Errorf("job %s has %d shards not done", job, remaining)
+	}
+
+	rulesLog, err := postgres.NewRulesLog()
+	if err != nil {
+		return err
+	}
+	err = loadRules(rulesLog)
+	rulesLog.Shutdown()
+	if err != nil {
+		return err
+	}
+
+	s, err := openSinks(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// one stream in (slot, txIdx, instIdx) order across the shards, merged at once
+	var ops []types.Operation
+	err = shards.LoadOperations(job, func(op types.Operation) {
+		ops = append(ops, op)
+	})
+	if err != nil {
+		return err
+	}
+	if len(ops) != 0 {
+		if err = sink.Merge(s, ops); err != nil {
+			return err
+		}
+	}
+	log.Logger.Info("shards applied", zap.String("job", job), zap.Int("operations", len(ops)))
+	return nil
+}
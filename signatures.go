@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"go.uber.org/zap"
+
+	"sol_block_extractord/log"
+	"sol_block_extractord/metrics"
+	"sol_block_extractord/source"
+)
+
+// SOLPollSignatures hands blockCh the finalized blocks from startHeight on in
+// slot order, each with the transactions sigs finds only, and closes it once
+// ctx is done. The finalized head of src is handed over as an empty block
+// when it has none, so the progress moves past the slots without memos.
+func SOLPollSignatures(ctx context.Context, sigs *source.Signatures, src source.BlockSource, startHeight uint64, blockCh chan SlotBlock) {
+	defer close(blockCh)
+
+	next := startHeight // the next slot to hand over
+	for ctx.Err() == nil {
+		head, err := src.Head(ctx, rpc.CommitmentFinalized)
+		if err != nil {
+			log.Logger.Warn("get finalized slot failed", zap.Error(err))
+			sleep(ctx, time.Second*3)
+			continue
+		}
+		metrics.SetHead(head)
+		if head < next {
+			sleep(ctx, time.Second)
+			continue
+		}
+
+		var slots int
+		err = sigs.Scan(ctx, next, head, func(slot uint64, slotSigs []solana.Signature) error {
+			b := SlotBlock{Slot: slot}
+			for attempt := 1; ; attempt++ {
+				var err error
+				b.GetBlockResult, b.TxIndexes, err = sigs.Block(ctx, slot, slotSigs)
+				if err == nil || ctx.Err() != nil {
+					break
+				}
+				log.Logger.Warn("get block transactions failed", zap.Uint64("slot", slot), zap.Int("attempt", attempt), zap.Error(err))
+				sleep(ctx, time.Second*5)
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			select {
+			case blockCh <- b:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			next = slot + 1
+			slots++
+			return nil
+		})
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			log.Logger.Warn("getSignaturesForAddress failed", zap.Uint64("from", next), zap.Uint64("to", head), zap.Error(err))
+			sleep(ctx, time.Second*3)
+			continue
+		}
+		log.Logger.Debug("signatures scanned", zap.Uint64("to", head), zap.Int("slots", slots))
+		if next <= head {
+			select {
+			case blockCh <- SlotBlock{Slot: head, GetBlockResult: &rpc.GetBlockResult{}}:
+			case <-ctx.Done():
+			}
+			next = head + 1
+		}
+		sleep(ctx, time.Second)
+	}
+	log.Logger.Info("signatures polling stopped", zap.Uint64("slot", next))
+}
@@ -0,0 +1,151 @@
+package sink
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"sol_block_extractord/log"
+	"sol_block_extractord/metrics"
+)
+
+// Chain is the finalized chain the provisional blocks are checked against.
+type Chain interface {
+	// Finalized is the last finalized slot.
+	Finalized() (uint64, error)
+	// Hash is the hash of the finalized block of slot, empty when the slot
+	// was skipped.
+	Hash(slot uint64) (string, error)
+	// Block is the finalized block of slot, its operations being the ones
+	// sent to PostOperations.
+	Block(slot uint64) (Block, error)
+}
+
+// Finality checks the blocks from slot From on against Chain.
+type Finality struct {
+	Chain Chain
+	From  uint64 // the first slot sent to PostOperations
+}
+
+// verify makes the provisional blocks final up to the finalized slot, unless
+// the finalized chain differs from them at a slot, which is rolled back. The
+// slots without a block are checked too, the finalized chain may have one.
+func (p *pipeline) verify() error {
+	if p.finality == nil || len(p.provisional) == 0 {
+		return nil
+	}
+
+	finalized, err := p.finality.Chain.Finalized()
+	if err != nil {
+		log.Logger.Warn("get the finalized slot failed", zap.Error(err))
+		return nil
+	}
+	end := p.provisional[len(p.provisional)-1].Slot
+	if finalized < end {
+		end = finalized
+	}
+
+	n := 0
+	slot := p.next
+	for ; slot <= end; slot++ {
+		hash, err := p.finality.Chain.Hash(slot)
+		if err != nil {
+			log.Logger.Warn("get the finalized block hash failed", zap.Uint64("slot", slot), zap.Error(err))
+			break
+		}
+
+		received := n < len(p.provisional) && p.provisional[n].Slot == slot
+		var want string
+		if received {
+			want = p.provisional[n].Hash
+		}
+		if hash != want {
+			if err = p.finalize(n, slot-1); err != nil {
+				return err
+			}
+			return p.rollback(slot, hash)
+		}
+		if received {
+			n++
+		}
+	}
+	return p.finalize(n, slot-1)
+}
+
+// finalize makes the first n provisional blocks final, the slots up to slot
+// being verified.
+func (p *pipeline) finalize(n int, slot uint64) error {
+	if slot+1 <= p.next {
+		return nil
+	}
+	if n > 0 {
+		if err := p.s.Write(Batch{Finalized: slot}); err != nil {
+			return fmt.Errorf("finalize slot %d err:%w", slot, err)
+		}
+		p.provisional = p.provisional[n:]
+	}
+	if p.checkpoint != nil {
+		p.checkpoint(slot)
+	}
+	p.next = slot + 1
+	return nil
+}
+
+// rollback removes the provisional operations from slot on, then checks the
+// ones of the finalized block of slot, if any, and of the later provisional
+// blocks against the ledger rebuilt without them.
+func (p *pipeline) rollback(slot uint64, hash string) error {
+	var finalized *Block
+	if hash != "" {
+		block, err := p.finality.Chain.Block(slot)
+		if err != nil {
+			log.Logger.Warn("get the finalized block failed", zap.Uint64("slot", slot), zap.Error(err))
+			return nil
+		}
+		finalized = &block
+	}
+
+	var later []Block
+	var dropped int
+	for _, block := range p.provisional {
+		if block.Slot > slot {
+			later = append(later, block)
+		} else {
+			dropped += len(block.Ops)
+		}
+	}
+
+	if err := p.load(); err != nil {
+		return fmt.Errorf("LoadOperations err:%w", err)
+	}
+	batch := Batch{Rollback: true, RollbackFrom: slot, Balances: make(map[string]int64), AllBalances: true}
+	if finalized != nil {
+		for _, operation := range finalized.Ops {
+			operation.Provisional = false
+			post(&batch, p.state, operation)
+		}
+		batch.Slots = append(batch.Slots, slot)
+	}
+	p.provisional = p.provisional[:0]
+	for _, block := range later {
+		for _, operation := range block.Ops {
+			operation.Provisional = true
+			post(&batch, p.state, operation)
+		}
+		batch.Slots = append(batch.Slots, block.Slot)
+		p.provisional = append(p.provisional, block)
+	}
+	batch.Balances = p.state.Balances()
+
+	if err := p.s.Write(batch); err != nil {
+		return fmt.Errorf("roll back from slot %d err:%w", slot, err)
+	}
+	metrics.Rollbacks.Inc()
+	log.Logger.Warn("provisional operations rolled back", zap.Uint64("slot", slot), zap.Int("dropped", dropped), zap.Bool("finalizedBlock", finalized != nil), zap.Int("checkedAgain", len(later)))
+
+	if p.checkpoint != nil {
+		p.checkpoint(slot)
+	}
+	p.next = slot + 1
+	return nil
+}
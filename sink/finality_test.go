@@ -0,0 +1,122 @@
+package sink
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"sol_block_extractord/config"
+	"sol_block_extractord/ledger"
+	"sol_block_extractord/types"
+)
+
+// chain is a finalized chain, the empty hashes are the skipped slots.
+type chain struct {
+	mu        sync.Mutex
+	finalized uint64
+	hashes    map[uint64]string
+	blocks    map[uint64]Block
+}
+
+func (c *chain) Finalized() (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.finalized, nil
+}
+
+func (c *chain) Hash(slot uint64) (string, error) {
+	return c.hashes[slot], nil
+}
+
+func (c *chain) Block(slot uint64) (Block, error) {
+	return c.blocks[slot], nil
+}
+
+func slotOp(slot uint64, txIdx int, op, from, to string, amt int64) types.Operation {
+	o := newOp(slot, txIdx, op, from, to, amt)
+	o.Slot = slot
+	return o
+}
+
+func TestFinality(t *testing.T) {
+	config.Cfg.Pg.BatchSize = 100
+	config.Cfg.Pg.BatchInterval = 5 * time.Millisecond
+	config.Cfg.Biz = testBiz()
+
+	// the finalized chain skipped slot 2 and has another block at slot 4
+	c := &chain{
+		hashes: map[uint64]string{3: "h3", 4: "h4'"},
+		blocks: map[uint64]Block{4: {Slot: 4, Hash: "h4'", Ops: []types.Operation{slotOp(4, 0, types.OpMint, "e", "", 5)}}},
+	}
+	received := make(chan struct{}, 10)
+	s := &memory{ops: []types.Operation{slotOp(1, 0, types.OpMint, "a", "", 100)}, written: func() { received <- struct{}{} }}
+
+	blockCh := make(chan Block, 10)
+	blockCh <- Block{Slot: 2, Hash: "h2", Ops: []types.Operation{slotOp(2, 0, types.OpTransfer, "a", "b", 60)}}
+	blockCh <- Block{Slot: 3, Hash: "h3", Ops: []types.Operation{slotOp(3, 0, types.OpMint, "c", "", 10)}}
+	blockCh <- Block{Slot: 4, Hash: "h4", Ops: []types.Operation{slotOp(4, 0, types.OpTransfer, "b", "d", 50)}}
+
+	checkpoints := make(chan uint64, 10)
+	done := make(chan error)
+	go func() {
+		done <- PostOperations(s, blockCh, func(slot uint64) { checkpoints <- slot }, &Finality{Chain: c, From: 2})
+	}()
+
+	<-received // the balances
+	<-received // the provisional blocks
+	c.mu.Lock()
+	c.finalized = 4
+	c.mu.Unlock()
+	for _, expected := range []uint64{2, 3, 4} {
+		select {
+		case slot := <-checkpoints:
+			require.Equal(t, expected, slot)
+		case <-time.After(time.Second):
+			t.Fatalf("no checkpoint %d", expected)
+		}
+	}
+	close(blockCh)
+	require.NoError(t, <-done)
+
+	require.Len(t, s.batches, 5)
+	require.True(t, s.batches[0].Rollback)
+	require.Equal(t, uint64(0), s.batches[0].RollbackFrom)
+
+	provisional := s.batches[1]
+	require.Equal(t, []uint64{2, 3, 4}, provisional.Slots)
+	require.Len(t, provisional.Ops, 3)
+	for _, op := range provisional.Ops {
+		require.True(t, op.Provisional)
+	}
+
+	// slot 2 dropped, the transfer of slot 4 is no longer funded
+	rollback := s.batches[2]
+	require.True(t, rollback.Rollback)
+	require.Equal(t, uint64(2), rollback.RollbackFrom)
+	require.Equal(t, []uint64{3, 4}, rollback.Slots)
+	require.Len(t, rollback.Ops, 1)
+	require.Equal(t, "c", rollback.Ops[0].From)
+	require.Len(t, rollback.Rejections, 1)
+	require.Equal(t, ledger.ReasonInsufficientBalance, rollback.Rejections[0].Reason)
+	require.Equal(t, map[string]int64{"a": 100, "c": 10}, rollback.Balances)
+	require.True(t, rollback.AllBalances)
+
+	require.Equal(t, Batch{Finalized: 3}, s.batches[3])
+
+	// slot 4 replaced by the finalized block
+	rollback = s.batches[4]
+	require.Equal(t, uint64(4), rollback.RollbackFrom)
+	require.Equal(t, []uint64{4}, rollback.Slots)
+	require.Len(t, rollback.Ops, 1)
+	require.False(t, rollback.Ops[0].Provisional)
+	require.Equal(t, map[string]int64{"a": 100, "c": 10, "e": 5}, rollback.Balances)
+
+	var final []string
+	for _, op := range s.ops {
+		require.False(t, op.Provisional)
+		final = append(final, op.From)
+	}
+	require.Equal(t, []string{"a", "c", "e"}, final)
+}
@@ -0,0 +1,221 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"sol_block_extractord/config"
+	"sol_block_extractord/types"
+)
+
+const (
+	jsonlOperations = "operations.jsonl"
+	jsonlRejections = "rejections.jsonl"
+)
+
+// JSONL appends the operations and rejections as JSON lines to files in a
+// directory, a merge rewrites them. The balances aren't kept, they are
+// derived from the operations.
+type JSONL struct {
+	operations *os.File
+	rejections *os.File
+}
+
+var _ Sink = (*JSONL)(nil)
+
+type jsonlRejection struct {
+	types.Operation
+	Reason string
+}
+
+func NewJSONL(dir string) (j *JSONL, err error) {
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return
+	}
+
+	j = &JSONL{}
+	j.operations, err = openJSONL(filepath.Join(dir, jsonlOperations))
+	if err != nil {
+		return nil, err
+	}
+	j.rejections, err = openJSONL(filepath.Join(dir, jsonlRejections))
+	if err != nil {
+		j.operations.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// openJSONL opens path for appending, dropping the partial line a crash may
+// have left at its end.
+func openJSONL(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := io.ReadAll(f)
+	if err == nil {
+		size := int64(bytes.LastIndexByte(content, '\n') + 1)
+		if size != int64(len(content)) {
+			err = f.Truncate(size)
+		}
+		if err == nil {
+			_, err = f.Seek(size, io.SeekStart)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (j *JSONL) Write(b Batch) error {
+	var ops, rejections bytes.Buffer
+	for _, op := range b.Ops {
+		if err := appendLine(&ops, op); err != nil {
+			return err
+		}
+	}
+	for _, r := range b.Rejections {
+		if err := appendLine(&rejections, jsonlRejection{Operation: r.Op, Reason: r.Reason}); err != nil {
+			return err
+		}
+	}
+
+	if b.Replace {
+		if err := replace(&j.operations, ops.Bytes()); err != nil {
+			return err
+		}
+		return replace(&j.rejections, rejections.Bytes())
+	}
+	if err := writeSync(j.operations, ops.Bytes()); err != nil {
+		return err
+	}
+	return writeSync(j.rejections, rejections.Bytes())
+}
+
+func appendLine(buf *bytes.Buffer, v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(line)
+	buf.WriteByte('\n')
+	return nil
+}
+
+func writeSync(f *os.File, content []byte) error {
+	if len(content) == 0 {
+		return nil
+	}
+	if _, err := f.Write(content); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// LoadOperations feeds the operations in (height, txIdx, instIdx) order, a
+// merge appends older ones after the newer.
+func (j *JSONL) LoadOperations(fn func(op types.Operation)) error {
+	var ops []types.Operation
+	err := readLines(j.operations.Name(), func(line []byte) error {
+		var op types.Operation
+		if err := json.Unmarshal(line, &op); err != nil {
+			return err
+		}
+		ops = append(ops, op)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(ops, func(i, k int) bool { return ops[i].Before(&ops[k]) })
+	for _, op := range ops {
+		fn(op)
+	}
+	return nil
+}
+
+func (j *JSONL) LoadRejections(fn func(r Rejection)) error {
+	return readLines(j.rejections.Name(), func(line []byte) error {
+		var r jsonlRejection
+		if err := json.Unmarshal(line, &r); err != nil {
+			return err
+		}
+		fn(Rejection{Op: r.Operation, Reason: r.Reason})
+		return nil
+	})
+}
+
+func readLines(path string, fn func(line []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if err = fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// replace rewrites the file of *f with the provisional lines and the ones of
+// the other ticks it holds followed by content, renamed over it at once.
+func replace(f **os.File, content []byte) error {
+	path := (*f).Name()
+	var kept bytes.Buffer
+	err := readLines(path, func(line []byte) error {
+		var op types.Operation
+		if err := json.Unmarshal(line, &op); err != nil {
+			return err
+		}
+		if op.Provisional || op.M.Tick != config.Cfg.Biz.Ins.Tick {
+			kept.Write(line)
+			kept.WriteByte('\n')
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	kept.Write(content)
+
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	err = writeSync(tmp, kept.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	(*f).Close()
+	*f, err = openJSONL(path)
+	return err
+}
+
+func (j *JSONL) Close() error {
+	return errors.Join(j.operations.Close(), j.rejections.Close())
+}
@@ -0,0 +1,261 @@
+package sink
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"sol_block_extractord/common"
+	"sol_block_extractord/config"
+	"sol_block_extractord/filters"
+	"sol_block_extractord/ledger"
+	"sol_block_extractord/log"
+	"sol_block_extractord/metrics"
+	"sol_block_extractord/types"
+)
+
+// PostOperations writes the operations of the blocks to s until blockCh is
+// closed, in batches of about Pg.BatchSize or every Pg.BatchInterval, a block
+// is never split. checkpoint, when not nil, is given the last slot of every
+// batch written. It stops at the first batch it fails to write.
+//
+// With finality the operations are provisional until their slot is
+// finalized, and checkpoint is only given finalized slots. When the finalized
+// chain differs from the blocks received at a slot, the operations from that
+// slot on are rolled back, the ones of the finalized block and of the later
+// blocks are checked again.
+func PostOperations(s Sink, blockCh chan Block, checkpoint func(slot uint64), finality *Finality) error {
+	p := &pipeline{s: s, checkpoint: checkpoint, finality: finality}
+	if finality != nil {
+		p.next = finality.From
+	}
+
+	if err := p.load(); err != nil {
+		return fmt.Errorf("LoadOperations err:%w", err)
+	}
+	log.Logger.Info("ledger loaded", zap.Any("supply", p.state.Supply()))
+	// the provisional operations of the previous run are received again from the checkpoint on
+	err := s.Write(Batch{Balances: p.state.Balances(), AllBalances: true, Rollback: finality != nil})
+	if err != nil {
+		return fmt.Errorf("write balances err:%w", err)
+	}
+
+	p.pending = Batch{Ops: make([]types.Operation, 0, config.Cfg.Pg.BatchSize), Balances: make(map[string]int64)}
+	return p.run(blockCh)
+}
+
+// MergeOperations adds the operations of the final blocks of blockCh to the
+// ones stored, for a backfill: once blockCh is closed they're merged, see
+// Merge, and checkpoint, when not nil, is given the last slot received.
+func MergeOperations(s Sink, blockCh chan Block, checkpoint func(slot uint64)) error {
+	var ops []types.Operation
+	var last uint64
+	for block := range blockCh {
+		ops = append(ops, block.Ops...)
+		last = block.Slot
+	}
+	if last == 0 {
+		return nil
+	}
+
+	if err := Merge(s, ops); err != nil {
+		return err
+	}
+	if checkpoint != nil {
+		checkpoint(last)
+	}
+	return nil
+}
+
+// Merge rebuilds the ledger from scratch with the final operations ops added
+// to the ones stored: the stored operations and rejections and ops are
+// checked again in chain order, the copy in ops of an operation winning, and
+// the result replaces what s stores in one batch, balances included. Nothing
+// else may write to s meanwhile, start must be stopped.
+func Merge(s Sink, ops []types.Operation) error {
+	seen := make(map[opKey]bool, len(ops))
+	for _, op := range ops {
+		seen[keyOf(op)] = true
+	}
+	// the provisional ones are rolled back by the next start, the other ticks
+	// are left alone
+	tick := config.Cfg.Biz.Ins.Tick
+	stored := func(op types.Operation) {
+		if op.Provisional || op.M.Tick != tick || seen[keyOf(op)] {
+			return
+		}
+		seen[keyOf(op)] = true
+		ops = append(ops, op)
+	}
+	if err := s.LoadOperations(stored); err != nil {
+		return fmt.Errorf("LoadOperations err:%w", err)
+	}
+	if err := s.LoadRejections(func(r Rejection) { stored(r.Op) }); err != nil {
+		return fmt.Errorf("LoadRejections err:%w", err)
+	}
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].Before(&ops[j]) })
+
+	state := ledger.New()
+	batch := Batch{Replace: true}
+	for _, op := range ops {
+		post(&batch, state, op)
+	}
+	batch.Balances, batch.AllBalances = state.Balances(), true
+	if err := s.Write(batch); err != nil {
+		return fmt.Errorf("write merged ledger err:%w", err)
+	}
+	log.Logger.Info("ledger merged", zap.Int("operations", len(batch.Ops)), zap.Int("rejections", len(batch.Rejections)), zap.Any("supply", state.Supply()))
+	return nil
+}
+
+// opKey identifies an operation by transaction and instruction, like the
+// unique constraint of the stored ones.
+type opKey struct {
+	txHash  string
+	instIdx int
+}
+
+func keyOf(op types.Operation) opKey {
+	return opKey{op.TxHash, op.InstIdx}
+}
+
+// run posts the blocks of blockCh until it's closed.
+func (p *pipeline) run(blockCh chan Block) error {
+	var err error
+	ticker := time.NewTicker(config.Cfg.Pg.BatchInterval)
+	defer ticker.Stop()
+
+	for {
+		var block Block
+		var ok bool
+		select {
+		case <-ticker.C:
+			if err = p.flush(); err != nil {
+				return err
+			}
+			if err = p.verify(); err != nil {
+				return err
+			}
+			continue
+		case block, ok = <-blockCh:
+			if !ok {
+				return p.flush()
+			}
+		}
+
+		p.add(block)
+		if p.pending.Len() >= config.Cfg.Pg.BatchSize {
+			if err = p.flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+type pipeline struct {
+	s          Sink
+	state      *ledger.Ledger
+	pending    Batch
+	checkpoint func(slot uint64)
+
+	finality    *Finality
+	provisional []Block // the blocks received and not finalized yet, in slot order
+	next        uint64  // the first slot not finalized yet
+}
+
+// load rebuilds the ledger from the final operations of s.
+func (p *pipeline) load() error {
+	p.state = ledger.New()
+	return p.s.LoadOperations(func(op types.Operation) {
+		if !op.Provisional || p.finality == nil {
+			p.state.Apply(op)
+		}
+	})
+}
+
+func (p *pipeline) add(block Block) {
+	for _, operation := range block.Ops {
+		operation.Provisional = p.finality != nil
+		post(&p.pending, p.state, operation)
+	}
+	p.pending.Slots = append(p.pending.Slots, block.Slot)
+	if p.finality != nil {
+		p.provisional = append(p.provisional, block)
+	}
+}
+
+func (p *pipeline) flush() error {
+	pending := &p.pending
+	if len(pending.Slots) == 0 && pending.Len() == 0 {
+		return nil
+	}
+
+	var batchCoordinate string
+	if len(pending.Ops) != 0 {
+		first, last := pending.Ops[0], pending.Ops[len(pending.Ops)-1]
+		batchCoordinate = fmt.Sprintf("[%s, %s]", common.TxCoordinate(first.BlockHeight, first.TxIdx, first.TxHash), common.TxCoordinate(last.BlockHeight, last.TxIdx, last.TxHash))
+	}
+	err := p.s.Write(*pending)
+	if err != nil {
+		log.Logger.Error("write batch failed, begin shutdown", zap.String("batch", batchCoordinate), zap.Error(err))
+		return fmt.Errorf("%s do [operations ==> sink] err:%w", batchCoordinate, err)
+	}
+
+	log.Logger.Info("batch succeeded", zap.String("batch", batchCoordinate), zap.Int("operations", len(pending.Ops)), zap.Int("rejections", len(pending.Rejections)))
+	if p.checkpoint != nil && p.finality == nil && len(pending.Slots) != 0 {
+		p.checkpoint(pending.Slots[len(pending.Slots)-1])
+	}
+	*pending = Batch{Slots: pending.Slots[:0], Ops: pending.Ops[:0], Rejections: pending.Rejections[:0], Balances: make(map[string]int64)}
+	return nil
+}
+
+// post checks operation against the ledger and adds it to pending, applied
+// or rejected.
+func post(pending *Batch, state *ledger.Ledger, operation types.Operation) {
+	logger := log.Logger.With(zap.Uint64("slot", operation.Slot), zap.Uint64("block_height", operation.BlockHeight), zap.Int("txIndex", operation.TxIdx), zap.String("signature", operation.TxHash))
+	logger.Debug("operation begin", zap.String("operation", operation.ToString()))
+
+	if state.Applied(operation) {
+		logger.Info("operation already applied, skip")
+		return
+	}
+
+	pass, reason := filters.FilterOperation(operation, state)
+	if !pass {
+		logger.Info("operation rejected", zap.String("reason", reason))
+		metrics.Rejection(metrics.StageLedger, reason)
+		pending.Rejections = append(pending.Rejections, Rejection{Op: operation, Reason: reason})
+		return
+	}
+
+	// the ledger moves on before the batch is written, the next operations are checked against it
+	state.Apply(operation)
+	pending.Ops = append(pending.Ops, operation)
+	if pending.Balances != nil {
+		for _, addr := range touched(operation) {
+			pending.Balances[addr] = state.Balance(addr)
+		}
+	}
+
+	if operation.M.Op == types.OpDeploy {
+		config.SetDeployHeight(operation.BlockHeight)
+	}
+
+	if operation.M.Op == types.OpBurn {
+		logger.Info("burned", zap.Int64("amount", operation.M.AmtN), zap.Any("supply", state.Supply()))
+	}
+}
+
+// touched are the addresses whose balance op may have changed, a cancel
+// credits the seller which is the sender.
+func touched(op types.Operation) []string {
+	switch op.M.Op {
+	case types.OpTransfer:
+		return []string{op.From, op.To}
+	case types.OpMint, types.OpBurn, types.OpList, types.OpBuy, types.OpCancel:
+		return []string{op.From}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package sink
+
+import (
+	"errors"
+
+	"sol_block_extractord/types"
+)
+
+// Sink stores the operations accepted by the pipeline, see PostOperations.
+type Sink interface {
+	// LoadOperations feeds the stored operations to fn in (height, txIdx,
+	// instIdx) order, the ledger is rebuilt from them on start.
+	LoadOperations(fn func(op types.Operation)) error
+	// LoadRejections feeds the stored rejections to fn, a merge checks them
+	// again along with the operations.
+	LoadRejections(fn func(r Rejection)) error
+	// Write stores b at once, the operations already stored are skipped.
+	Write(b Batch) error
+	Close() error
+}
+
+// Block is the operations of a slot sent to PostOperations. Every slot is
+// sent in order, the ones without operations too so the checkpoint moves on.
+type Block struct {
+	Slot uint64
+	Hash string // checked against the finalized chain when the block is provisional
+	Ops  []types.Operation
+}
+
+// Rejection is an operation the ledger refused.
+type Rejection struct {
+	Op     types.Operation
+	Reason string
+}
+
+// Batch is what the pipeline writes at once: the accepted operations, the
+// rejected ones and the balances of the addresses they touched.
+type Batch struct {
+	Slots      []uint64 // the slots whose operations are all in this batch or the earlier ones
+	Ops        []types.Operation
+	Rejections []Rejection
+	Balances   map[string]int64 // a zero balance removes the address
+	// AllBalances tells Balances holds every balance, the stored ones
+	// missing from it are removed.
+	AllBalances bool
+
+	// Rollback removes the provisional operations and rejections from slot
+	// RollbackFrom on, before the ones of the batch are stored.
+	Rollback     bool
+	RollbackFrom uint64
+	// Finalized, when not 0, makes the provisional operations and rejections
+	// up to that slot final.
+	Finalized uint64
+
+	// Replace removes the final operations and rejections of the configured
+	// tick before the ones of the batch are stored, a merge writes the whole
+	// ledger checked again in one batch.
+	Replace bool
+}
+
+func (b *Batch) Len() int {
+	return len(b.Ops) + len(b.Rejections)
+}
+
+// FanOut writes to every sink, the first one is the source of LoadOperations
+// and LoadRejections and is written last: a batch it hasn't stored is written
+// again after a restart, the other sinks see it at least once.
+type FanOut []Sink
+
+func (f FanOut) LoadOperations(fn func(op types.Operation)) error {
+	if len(f) == 0 {
+		return nil
+	}
+	return f[0].LoadOperations(fn)
+}
+
+func (f FanOut) LoadRejections(fn func(r Rejection)) error {
+	if len(f) == 0 {
+		return nil
+	}
+	return f[0].LoadRejections(fn)
+}
+
+func (f FanOut) Write(b Batch) error {
+	for i := len(f) - 1; i >= 0; i-- {
+		if err := f[i].Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f FanOut) Close() error {
+	var errs []error
+	for _, s := range f {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
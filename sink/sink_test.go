@@ -0,0 +1,232 @@
+package sink
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	"sol_block_extractord/config"
+	"sol_block_extractord/ledger"
+	"sol_block_extractord/types"
+)
+
+// memory keeps the batches written to it.
+type memory struct {
+	batches    []Batch
+	ops        []types.Operation
+	rejections []Rejection
+	written    func() // called on every write
+}
+
+func (m *memory) LoadOperations(fn func(op types.Operation)) error {
+	for _, op := range m.ops {
+		fn(op)
+	}
+	return nil
+}
+
+func (m *memory) LoadRejections(fn func(r Rejection)) error {
+	for _, r := range m.rejections {
+		fn(r)
+	}
+	return nil
+}
+
+func (m *memory) Write(b Batch) error {
+	b.Slots = append([]uint64(nil), b.Slots...)
+	b.Ops = append([]types.Operation(nil), b.Ops...)
+	b.Rejections = append([]Rejection(nil), b.Rejections...)
+	m.batches = append(m.batches, b)
+	if b.Rollback {
+		ops := m.ops[:0]
+		for _, op := range m.ops {
+			if !op.Provisional || op.Slot < b.RollbackFrom {
+				ops = append(ops, op)
+			}
+		}
+		m.ops = ops
+	}
+	if b.Replace {
+		ops := m.ops[:0]
+		for _, op := range m.ops {
+			if op.Provisional || op.M.Tick != config.Cfg.Biz.Ins.Tick {
+				ops = append(ops, op)
+			}
+		}
+		m.ops = ops
+		m.rejections = nil
+	}
+	m.ops = append(m.ops, b.Ops...)
+	m.rejections = append(m.rejections, b.Rejections...)
+	for i := range m.ops {
+		if b.Finalized != 0 && m.ops[i].Slot <= b.Finalized {
+			m.ops[i].Provisional = false
+		}
+	}
+	if m.written != nil {
+		m.written()
+	}
+	return nil
+}
+
+func (m *memory) Close() error {
+	return nil
+}
+
+// testBiz is the protocol of the tests, its transfers name the recipient by a
+// short id rather than an address so the op set doesn't declare the to field.
+func testBiz() config.Business {
+	ops := types.DefaultOps(false)
+	for i := range ops {
+		if ops[i].Name == types.OpTransfer {
+			ops[i].Fields = []string{types.ColumnNameAmt}
+		}
+	}
+	return config.Business{DeployHeight: 1, Ins: config.Inscription{P: "test-20", Tick: "TEST", Ops: ops}}
+}
+
+func newOp(height uint64, txIdx int, op, from, to string, amt int64) types.Operation {
+	o := types.Operation{TxHash: "tx" + strconv.FormatUint(height, 10) + "-" + strconv.Itoa(txIdx), From: from, To: to, Value: uint256.NewInt(0),
+		M: types.Memo{P: "test-20", Tick: "TEST", Op: op, Amt: strconv.FormatInt(amt, 10), AmtN: amt}}
+	o.SetupBlockInfo(height, 1700000000, txIdx)
+	return o
+}
+
+func TestPostOperations(t *testing.T) {
+	config.Cfg.Pg.BatchSize = 2
+	config.Cfg.Pg.BatchInterval = time.Hour
+	config.Cfg.Biz = testBiz()
+
+	s := &memory{ops: []types.Operation{newOp(2, 0, types.OpMint, "a", "", 100)}}
+	blockCh := make(chan Block, 10)
+	blockCh <- Block{Slot: 2, Ops: []types.Operation{newOp(2, 0, types.OpMint, "a", "", 100)}} // replayed
+	blockCh <- Block{Slot: 3, Ops: []types.Operation{newOp(3, 0, types.OpTransfer, "a", "b", 150), newOp(3, 1, types.OpTransfer, "a", "b", 100)}}
+	blockCh <- Block{Slot: 4}
+	blockCh <- Block{Slot: 5, Ops: []types.Operation{newOp(5, 0, types.OpMint, "c", "", 10)}}
+	close(blockCh)
+
+	var checkpoints []uint64
+	require.NoError(t, PostOperations(s, blockCh, func(slot uint64) { checkpoints = append(checkpoints, slot) }, nil))
+
+	require.Len(t, s.batches, 3)
+	require.Equal(t, Batch{Balances: map[string]int64{"a": 100}, AllBalances: true}, s.batches[0])
+
+	require.Equal(t, []uint64{2, 3}, s.batches[1].Slots)
+	require.Equal(t, []Rejection{{Op: newOp(3, 0, types.OpTransfer, "a", "b", 150), Reason: ledger.ReasonInsufficientBalance}}, s.batches[1].Rejections)
+	require.Equal(t, []types.Operation{newOp(3, 1, types.OpTransfer, "a", "b", 100)}, s.batches[1].Ops)
+	require.Equal(t, map[string]int64{"a": 0, "b": 100}, s.batches[1].Balances)
+
+	require.Equal(t, []uint64{4, 5}, s.batches[2].Slots)
+	require.Equal(t, map[string]int64{"c": 10}, s.batches[2].Balances)
+	require.Len(t, s.ops, 3)
+	require.Equal(t, []uint64{3, 5}, checkpoints)
+}
+
+// TestMergeOperations checks a backfill checks the stored operations and
+// rejections again along with the backfilled ones, in chain order, and
+// replaces the ledger with the result.
+func TestMergeOperations(t *testing.T) {
+	config.Cfg.Biz = testBiz()
+
+	s := &memory{
+		ops:        []types.Operation{newOp(10, 0, types.OpMint, "a", "", 100)},
+		rejections: []Rejection{{Op: newOp(11, 0, types.OpTransfer, "b", "c", 20), Reason: ledger.ReasonInsufficientBalance}},
+	}
+	blockCh := make(chan Block, 10)
+	blockCh <- Block{Slot: 2, Ops: []types.Operation{newOp(2, 0, types.OpMint, "b", "", 50)}}
+	blockCh <- Block{Slot: 3, Ops: []types.Operation{newOp(3, 0, types.OpTransfer, "a", "d", 10)}}
+	blockCh <- Block{Slot: 10, Ops: []types.Operation{newOp(10, 0, types.OpMint, "a", "", 100)}} // stored by start
+	close(blockCh)
+
+	var checkpoints []uint64
+	require.NoError(t, MergeOperations(s, blockCh, func(slot uint64) { checkpoints = append(checkpoints, slot) }))
+
+	require.Len(t, s.batches, 1)
+	b := s.batches[0]
+	require.True(t, b.Replace)
+	require.Equal(t, []types.Operation{newOp(2, 0, types.OpMint, "b", "", 50), newOp(10, 0, types.OpMint, "a", "", 100), newOp(11, 0, types.OpTransfer, "b", "c", 20)}, b.Ops)
+	require.Equal(t, []Rejection{{Op: newOp(3, 0, types.OpTransfer, "a", "d", 10), Reason: ledger.ReasonInsufficientBalance}}, b.Rejections)
+	require.Equal(t, map[string]int64{"a": 100, "b": 30, "c": 20}, b.Balances)
+	require.True(t, b.AllBalances)
+	require.Equal(t, b.Ops, s.ops)
+	require.Equal(t, b.Rejections, s.rejections)
+	require.Equal(t, []uint64{10}, checkpoints)
+}
+
+func TestFanOut(t *testing.T) {
+	var order []string
+	first := &memory{written: func() { order = append(order, "first") }}
+	second := &memory{written: func() { order = append(order, "second") }}
+	f := FanOut{first, second}
+
+	b := Batch{Ops: []types.Operation{newOp(2, 0, types.OpMint, "a", "", 100)}}
+	require.NoError(t, f.Write(b))
+	require.Equal(t, []string{"second", "first"}, order)
+	require.Equal(t, b.Ops, first.ops)
+	require.Equal(t, b.Ops, second.ops)
+
+	second.ops = nil
+	var loaded []types.Operation
+	require.NoError(t, f.LoadOperations(func(op types.Operation) { loaded = append(loaded, op) }))
+	require.Equal(t, b.Ops, loaded)
+	require.NoError(t, f.Close())
+}
+
+func TestJSONL(t *testing.T) {
+	dir := t.TempDir()
+	j, err := NewJSONL(dir)
+	require.NoError(t, err)
+
+	ops := []types.Operation{newOp(2, 0, types.OpMint, "a", "", 100), newOp(3, 1, types.OpTransfer, "a", "b", 40)}
+	ops[1].Value = uint256.NewInt(7)
+	require.NoError(t, j.Write(Batch{Ops: ops[:1]}))
+	require.NoError(t, j.Write(Batch{Ops: ops[1:], Rejections: []Rejection{{Op: ops[0], Reason: "r"}}}))
+	require.NoError(t, j.Close())
+
+	// a crash in the middle of a line
+	f, err := os.OpenFile(filepath.Join(dir, jsonlOperations), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"BlockHeight":4`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	j, err = NewJSONL(dir)
+	require.NoError(t, err)
+	defer j.Close()
+
+	// a backfilled operation appended after the newer ones is loaded in chain order
+	older := newOp(1, 0, types.OpMint, "c", "", 5)
+	require.NoError(t, j.Write(Batch{Ops: []types.Operation{older}}))
+
+	var loaded []types.Operation
+	require.NoError(t, j.LoadOperations(func(op types.Operation) { loaded = append(loaded, op) }))
+	require.Equal(t, append([]types.Operation{older}, ops...), loaded)
+
+	var rejections []Rejection
+	require.NoError(t, j.LoadRejections(func(r Rejection) { rejections = append(rejections, r) }))
+	require.Equal(t, []Rejection{{Op: ops[0], Reason: "r"}}, rejections)
+
+	// a merge replaces the final operations and rejections of the tick
+	config.Cfg.Biz.Ins.Tick = "TEST"
+	provisional := newOp(5, 0, types.OpMint, "d", "", 5)
+	provisional.Provisional = true
+	require.NoError(t, j.Write(Batch{Ops: []types.Operation{provisional}}))
+	require.NoError(t, j.Write(Batch{Replace: true, Ops: ops[:1], AllBalances: true}))
+
+	loaded = nil
+	require.NoError(t, j.LoadOperations(func(op types.Operation) { loaded = append(loaded, op) }))
+	require.Equal(t, []types.Operation{ops[0], provisional}, loaded)
+	rejections = nil
+	require.NoError(t, j.LoadRejections(func(r Rejection) { rejections = append(rejections, r) }))
+	require.Empty(t, rejections)
+
+	require.NoError(t, j.Write(Batch{Ops: ops[1:]}))
+	loaded = nil
+	require.NoError(t, j.LoadOperations(func(op types.Operation) { loaded = append(loaded, op) }))
+	require.Equal(t, []types.Operation{ops[0], ops[1], provisional}, loaded)
+}
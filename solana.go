@@ -5,17 +5,20 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"os"
+	"strconv"
 	"time"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
-	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
 	"github.com/holiman/uint256"
+	"go.uber.org/zap"
 
-	"sol_block_extractord/common"
+	"sol_block_extractord/config"
 	"sol_block_extractord/finished_block_manager"
 	"sol_block_extractord/log"
+	"sol_block_extractord/metrics"
+	"sol_block_extractord/sink"
+	"sol_block_extractord/source"
 	"sol_block_extractord/types"
 )
 
@@ -24,19 +27,115 @@ const (
 	SystemInstructionTransfer = 2
 )
 
+// errDecodeTx means the block data is broken, indexing can't go on past it.
+var errDecodeTx = errors.New("decode tx")
+
 var (
 	memoProgramId           = solana.MustPublicKeyFromBase58("MemoSq4gqABAXKb96qnH8TysNcWxMyWCqXgDLGmfcHr")
 	systemTransferProgramId = solana.MustPublicKeyFromBase58("11111111111111111111111111111111")
 )
 
-func SOLDispatchTasks(startHeight uint64, taskCh chan uint64) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// sleep waits d, it returns false when ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// newRPC is the source of the configured RPC endpoint.
+func newRPC() *source.RPC {
+	return source.NewRPC(config.Cfg.RPC.URL)
+}
+
+// commitment is the configured commitment of the blocks indexed.
+func commitment() rpc.CommitmentType {
+	if config.Cfg.Confirmed() {
+		return rpc.CommitmentConfirmed
+	}
+	return rpc.CommitmentFinalized
+}
+
+// rpcChain is the finalized chain of the RPC endpoint.
+type rpcChain struct {
+	ctx context.Context
+	src *source.RPC
+}
+
+var _ sink.Chain = (*rpcChain)(nil)
+
+func (c *rpcChain) Finalized() (uint64, error) {
+	return c.src.Head(c.ctx, rpc.CommitmentFinalized)
+}
+
+func (c *rpcChain) Hash(slot uint64) (string, error) {
+	return c.src.Hash(c.ctx, slot, rpc.CommitmentFinalized)
+}
+
+func (c *rpcChain) Block(slot uint64) (sink.Block, error) {
+	b, err := c.src.Block(c.ctx, slot, rpc.CommitmentFinalized)
+	if err != nil {
+		return sink.Block{}, err
+	}
+	if b == nil {
+		return sink.Block{}, fmt.Errorf("finalized block %d not available", slot)
+	}
+	return parseBlock(SlotBlock{Slot: slot, GetBlockResult: b})
+}
+
+// dispatchWindow is the most slots listed at once.
+const dispatchWindow = 10000
+
+// dispatchSlots feeds taskCh the slots of src from to to which may have a
+// block, it returns false once ctx is done.
+func dispatchSlots(ctx context.Context, src source.BlockSource, from, to uint64, commitment rpc.CommitmentType, taskCh chan uint64) bool {
+	for first := from; first <= to; first += dispatchWindow {
+		last := first + dispatchWindow - 1
+		if last > to {
+			last = to
+		}
 
-	endpoint := rpc.LocalNet_RPC
-	cli := rpc.New(endpoint)
+		var slots []uint64
+		for errCnt := 1; ; errCnt++ {
+			var err error
+			slots, err = src.Slots(ctx, first, last, commitment)
+			if ctx.Err() != nil {
+				log.Logger.Info("dispatch stopped", zap.Uint64("slot", first-1))
+				return false
+			}
+			if err == nil {
+				break
+			}
+			log.Logger.Warn("list slots failed", zap.Uint64("from", first), zap.Uint64("to", last), zap.Int("attempt", errCnt), zap.Error(err))
+			sleep(ctx, time.Second*3)
+		}
 
-	taskCh <- startHeight
+		for _, slot := range slots {
+			select {
+			case taskCh <- slot:
+			case <-ctx.Done():
+				log.Logger.Info("dispatch stopped", zap.Uint64("slot", slot-1))
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SOLDispatchTasks feeds taskCh the slots of src from startHeight on up to the
+// head at the configured commitment, and closes it once ctx is done.
+func SOLDispatchTasks(ctx context.Context, src source.BlockSource, startHeight uint64, taskCh chan uint64) {
+	defer close(taskCh)
+
+	select {
+	case taskCh <- startHeight:
+	case <-ctx.Done():
+		return
+	}
 	cursor := startHeight
 
 	var errCnt int
@@ -45,101 +144,136 @@ func SOLDispatchTasks(startHeight uint64, taskCh chan uint64) {
 	for {
 		errCnt = 0
 		start = time.Now()
-		latestBlockHeight, err := cli.GetBlockHeight(ctx, rpc.CommitmentFinalized)
+		head, err := src.Head(ctx, commitment())
 		duration = time.Now().Sub(start)
+		if ctx.Err() != nil {
+			log.Logger.Info("dispatch stopped", zap.Uint64("slot", cursor))
+			return
+		}
 		if err != nil {
 			errCnt++
-			log.Logger.Warn(fmt.Sprintf("sol GetBlockHeight failed %d times with err %s, time elapse ms %d", errCnt, err.Error(), duration.Milliseconds()))
-			time.Sleep(time.Second * 3)
+			log.Logger.Warn("head failed", zap.Int("attempt", errCnt), zap.Duration("elapsed", duration), zap.Error(err))
+			sleep(ctx, time.Second*3)
 			continue
 		}
-		log.Logger.Info(fmt.Sprintf("sol GetBlockHeight success with retry count %d, time elapse ms %d", errCnt, duration.Milliseconds()))
+		metrics.SetHead(head)
+		log.Logger.Debug("head succeeded", zap.Uint64("head", head), zap.Int("retries", errCnt), zap.Duration("elapsed", duration))
 
-		if latestBlockHeight <= cursor {
-			log.Logger.Warn(fmt.Sprintf("sol GetBlockHeight remote height %d <= local height %d", latestBlockHeight, cursor))
-			time.Sleep(time.Second * 1)
+		if head <= cursor {
+			log.Logger.Debug("head not ahead of the dispatched slot", zap.Uint64("head", head), zap.Uint64("slot", cursor))
+			sleep(ctx, time.Second*1)
 			continue
 		}
-		log.Logger.Info(fmt.Sprintf("sol GetBlockHeight: cursor %d, remote height %d", cursor, latestBlockHeight))
+		log.Logger.Info("dispatch up to the head", zap.Uint64("slot", cursor), zap.Uint64("head", head))
 
-		for height := cursor + 1; height <= latestBlockHeight; height++ {
-			taskCh <- height
+		if !dispatchSlots(ctx, src, cursor+1, head, commitment(), taskCh) {
+			return
 		}
 
-		cursor = latestBlockHeight
+		cursor = head
 	}
 }
 
-func SOLSyncBlocks(workerId int, taskCh chan uint64, blockCh chan *rpc.GetBlockResult) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// SOLDispatchRange feeds taskCh the finalized slots of src from to to, then
+// closes it.
+func SOLDispatchRange(ctx context.Context, src source.BlockSource, from, to uint64, taskCh chan uint64) {
+	defer close(taskCh)
 
-	endpoint := rpc.LocalNet_RPC
-	cli := rpc.New(endpoint)
+	if dispatchSlots(ctx, src, from, to, rpc.CommitmentFinalized, taskCh) {
+		log.Logger.Info("dispatch done", zap.Uint64("slot", to))
+	}
+}
+
+// SlotBlock is a block with its slot, which the block doesn't hold.
+type SlotBlock struct {
+	Slot uint64
+	*rpc.GetBlockResult
+	TxIndexes []int // the index in the block of each transaction, when only some of them were fetched
+}
+
+// txIndex is the index in the block of the i-th transaction of b.
+func (b SlotBlock) txIndex(i int) int {
+	if b.TxIndexes != nil {
+		return b.TxIndexes[i]
+	}
+	return i
+}
 
-	workerBufferCh := make(chan *rpc.GetBlockResult, 50)
+// SOLSyncBlocks fetches the tasks' blocks from src at commitment and hands them
+// to blockCh in slot order, until taskCh is closed or ctx is done. It returns
+// once its blocks are handed over.
+func SOLSyncBlocks(ctx context.Context, src source.BlockSource, workerId int, taskCh chan uint64, blockCh chan SlotBlock, commitment rpc.CommitmentType, tracker finished_block_manager.ProgressTracker) {
+	workerBufferCh := make(chan SlotBlock, 50)
+	bufferDone := make(chan struct{})
+	defer func() {
+		close(workerBufferCh)
+		<-bufferDone
+	}()
 	go func() {
+		defer close(bufferDone)
 		for b := range workerBufferCh {
-			taskCoordinate := fmt.Sprintf("(workerId%d, task%d) workerBuffer length:%d", workerId, *b.BlockHeight, len(workerBufferCh))
-			var waitCnt int64 = 0
-			for { // wait the worker's turn to commit finished work
-				fh := finished_block_manager.Get()
-				if b.ParentSlot == fh {
-					log.Logger.Info(fmt.Sprintf("task %s committed with wait time ms:%v", taskCoordinate, waitCnt*time.Millisecond.Milliseconds()))
-					break
-				}
-				time.Sleep(time.Millisecond * 5)
-				waitCnt++
-				if waitCnt%1000 == 0 {
-					log.Logger.Info(fmt.Sprintf("task %s wait with time ms:%v", taskCoordinate, waitCnt*time.Millisecond.Milliseconds()))
+			fields := []zap.Field{zap.Int("worker", workerId), zap.Uint64("slot", b.Slot), zap.Int("buffered", len(workerBufferCh))}
+			start := time.Now()
+			finished := tracker.Wait(b.ParentSlot) // wait the worker's turn to commit finished work
+			ticker := time.NewTicker(time.Second * 5)
+		wait:
+			for {
+				select {
+				case <-finished:
+					log.Logger.Debug("task committed", append(fields, zap.Duration("waited", time.Since(start)))...)
+					break wait
+				case <-ticker.C:
+					log.Logger.Info("task waiting its turn to commit", append(fields, zap.Duration("waited", time.Since(start)))...)
+				case <-ctx.Done():
+					ticker.Stop()
+					return
 				}
 			}
-			blockCh <- b
+			ticker.Stop()
+
+			select {
+			case blockCh <- b:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
+	getBlockSeconds := metrics.GetBlockSeconds.WithLabelValues(strconv.Itoa(workerId))
 	var start, end time.Time
 	for task := range taskCh {
-		taskCoordinate := fmt.Sprintf("(workerId%d, task%d)", workerId, task)
-		log.Logger.Info(fmt.Sprintf("task %s begin", taskCoordinate))
-
-		includeRewards := false
+		logger := log.Logger.With(zap.Int("worker", workerId), zap.Uint64("slot", task))
+		logger.Debug("task begin")
 
 		getBlockFailedCnt := 0
-		getBlockNilCnt := 0
 		for {
 			start = time.Now()
-			b, err := cli.GetBlockWithOpts(ctx, task, &rpc.GetBlockOpts{
-				Encoding:           solana.EncodingBase64,
-				Commitment:         rpc.CommitmentConfirmed,
-				TransactionDetails: rpc.TransactionDetailsFull,
-				Rewards:            &includeRewards,
-			})
+			b, err := src.Block(ctx, task, commitment)
 			end = time.Now()
-			durationMs := end.Sub(start).Milliseconds()
+			elapsed := end.Sub(start)
+			if ctx.Err() != nil {
+				logger.Info("task stopped")
+				return
+			}
+			getBlockSeconds.Observe(elapsed.Seconds())
 			if err != nil {
-				var rpcError *jsonrpc.RPCError
-				if errors.As(err, &rpcError) {
-					if rpcError.Code == -32007 {
-						log.Logger.Warn(fmt.Sprintf("slot %d skipped, we skipped also, err: %v", task, rpcError))
-						break
-					}
-				}
 				getBlockFailedCnt++
-				log.Logger.Warn(fmt.Sprintf("task %s do 'GetBlock' failed %d times with err: [%v], elapse ms:%v", taskCoordinate, getBlockFailedCnt, err, durationMs))
-				time.Sleep(time.Second * 5)
+				logger.Warn("getBlock failed", zap.Int("attempt", getBlockFailedCnt), zap.Duration("elapsed", elapsed), zap.Error(err))
+				sleep(ctx, time.Second*5)
 				continue
 			}
 			if b == nil {
-				getBlockNilCnt++
-				log.Logger.Warn(fmt.Sprintf("task %s do 'GetBlock' returns nil %d times ,elapse ms:%v", taskCoordinate, getBlockNilCnt, durationMs))
-				time.Sleep(time.Second * 5)
-				continue
+				logger.Warn("slot skipped, we skipped also")
+				break
 			}
-			log.Logger.Info(fmt.Sprintf("task %s do 'GetBlock' succeed with failed count %d with returns nil count %d, elapse ms:%v", taskCoordinate, getBlockFailedCnt, getBlockNilCnt, durationMs))
+			logger.Debug("getBlock succeeded", zap.Int("failed", getBlockFailedCnt), zap.Duration("elapsed", elapsed))
 
-			workerBufferCh <- b
-			log.Logger.Info(fmt.Sprintf("task %s commit to worker buffer", taskCoordinate))
+			select {
+			case workerBufferCh <- SlotBlock{Slot: task, GetBlockResult: b}:
+			case <-ctx.Done():
+				return
+			}
+			logger.Debug("task commit to worker buffer")
 			break
 		}
 	}
@@ -157,15 +291,39 @@ func isMemoProgramId(id solana.PublicKey) bool {
 	return isTheProgramId(memoProgramId, id)
 }
 
-func findInstructionIndexes(publicKeys []solana.PublicKey, instructions []solana.CompiledInstruction, filter func(solana.PublicKey) bool) (indexes []int) {
+func findInstructionIndexes(publicKeys []solana.PublicKey, instructions []solana.CompiledInstruction, filter func(solana.PublicKey) bool) (indexes []int, err error) {
 	for index, inst := range instructions {
-		if filter(publicKeys[inst.ProgramIDIndex]) {
+		programId, err := accountKey(publicKeys, inst.ProgramIDIndex)
+		if err != nil {
+			return nil, err
+		}
+		if filter(programId) {
 			indexes = append(indexes, index)
 		}
 	}
 	return
 }
 
+// accountKeys are the keys the account indexes of tx refer to: the static
+// ones followed, for a v0 transaction, by the writable then the readonly ones
+// its lookup tables loaded, as meta reports them.
+func accountKeys(tx *solana.Transaction, meta *rpc.TransactionMeta) []solana.PublicKey {
+	keys := tx.Message.AccountKeys
+	if tx.Message.IsVersioned() && meta != nil {
+		keys = append(append(append([]solana.PublicKey{}, keys...), meta.LoadedAddresses.Writable...), meta.LoadedAddresses.ReadOnly...)
+	}
+	return keys
+}
+
+// accountKey is the key at index, keys missing it means the block data is
+// broken, like the addresses of a lookup table not loaded.
+func accountKey(keys []solana.PublicKey, index uint16) (solana.PublicKey, error) {
+	if int(index) >= len(keys) {
+		return solana.PublicKey{}, fmt.Errorf("%w: account index %d out of %d keys", errDecodeTx, index, len(keys))
+	}
+	return keys[index], nil
+}
+
 func parseSystemInstructionCallData(callData []byte) (sysInst uint32, value uint64, err error) {
 	switch len(callData) {
 	case 12:
@@ -183,9 +341,8 @@ func parseSystemInstructionCallData(callData []byte) (sysInst uint32, value uint
 func ParseTx(blockHeight uint64, txIdx int, txWithMeta *rpc.TransactionWithMeta, parseMemo func(string) (types.Memo, error)) (op types.Operation, err error) {
 	tx, err := txWithMeta.GetTransaction()
 	if err != nil {
-		// TODO FIXME
-		// TODO release resources
-		os.Exit(-1)
+		err = fmt.Errorf("%w: %v", errDecodeTx, err)
+		return
 	}
 
 	if len(tx.Signatures) != 1 {
@@ -194,21 +351,31 @@ func ParseTx(blockHeight uint64, txIdx int, txWithMeta *rpc.TransactionWithMeta,
 		return
 	}
 
-	txCoordinate := common.TxCoordinate(blockHeight, txIdx, tx.Signatures[0].String())
-	log.Logger.Info(fmt.Sprintf("--%s begin", txCoordinate))
+	log.Logger.Debug("parse tx", zap.Uint64("block_height", blockHeight), zap.Int("txIndex", txIdx), zap.Stringer("signature", tx.Signatures[0]))
 
 	if txWithMeta.Meta.Err != nil {
 		err = errors.New(fmt.Sprintf("tx not success on chain with err: %v", txWithMeta.Meta.Err))
 		return
 	}
 
-	memoProgramInstructionIndexes := findInstructionIndexes(tx.Message.AccountKeys, tx.Message.Instructions, isMemoProgramId)
+	keys := accountKeys(tx, txWithMeta.Meta)
+	memoProgramInstructionIndexes, err := findInstructionIndexes(keys, tx.Message.Instructions, isMemoProgramId)
+	if err != nil {
+		return
+	}
 	if len(memoProgramInstructionIndexes) == 0 {
 		err = errors.New(fmt.Sprintf("no memo instruction"))
 		return
 	}
 
-	op.MemoRaw = string(tx.Message.Instructions[memoProgramInstructionIndexes[0]].Data)
+	op.InstIdx = memoProgramInstructionIndexes[0]
+	memoInst := tx.Message.Instructions[op.InstIdx]
+	if len(memoInst.Accounts) == 0 {
+		err = errors.New(fmt.Sprintf("memo instruction without signer"))
+		return
+	}
+
+	op.MemoRaw = string(memoInst.Data)
 	op.M, err = parseMemo(op.MemoRaw)
 	if err != nil {
 		return
@@ -216,39 +383,73 @@ func ParseTx(blockHeight uint64, txIdx int, txWithMeta *rpc.TransactionWithMeta,
 
 	op.Denom = NativeDenom
 	if op.M.ShouldParseTxTransferValue() {
-		systemTransferProgramInstructionIndexes := findInstructionIndexes(tx.Message.AccountKeys, tx.Message.Instructions, isSystemTransferProgramId)
+		systemTransferProgramInstructionIndexes, indexErr := findInstructionIndexes(keys, tx.Message.Instructions, isSystemTransferProgramId)
+		if indexErr != nil {
+			err = indexErr
+			return
+		}
 		if len(systemTransferProgramInstructionIndexes) == 0 {
 			err = errors.New(fmt.Sprintf("no system transfer instruction"))
 			return
 		}
 
-		if tx.Message.Instructions[memoProgramInstructionIndexes[0]].Accounts[0] != tx.Message.Instructions[systemTransferProgramInstructionIndexes[0]].Accounts[0] {
-			err = errors.New(fmt.Sprintf("memo instruction from addr %v != system transfer instruction from addr %v",
-				tx.Message.Instructions[memoProgramInstructionIndexes[0]].Accounts[0],
-				tx.Message.Instructions[systemTransferProgramInstructionIndexes[0]].Accounts[0],
-			))
+		// the payment is the first system transfer signed by the memo sender, a buy may carry other system instructions
+		memoFrom := memoInst.Accounts[0]
+		transferIdx := -1
+		var value uint64
+		for _, idx := range systemTransferProgramInstructionIndexes {
+			inst := tx.Message.Instructions[idx]
+			if len(inst.Accounts) < 2 || inst.Accounts[0] != memoFrom {
+				continue
+			}
+
+			systemInstructionType, v, parseErr := parseSystemInstructionCallData(inst.Data)
+			if parseErr != nil || systemInstructionType != SystemInstructionTransfer {
+				continue
+			}
+
+			transferIdx = idx
+			value = v
+			break
+		}
+		if transferIdx == -1 {
+			from, keyErr := accountKey(keys, memoFrom)
+			if keyErr != nil {
+				err = keyErr
+				return
+			}
+			err = errors.New(fmt.Sprintf("no system transfer instruction from memo instruction from addr %v", from))
 			return
 		}
 
-		systemInstructionType, value, err := parseSystemInstructionCallData(tx.Message.Instructions[systemTransferProgramInstructionIndexes[0]].Data)
-		if err != nil {
-			return op, err
+		transferInst := tx.Message.Instructions[transferIdx]
+		var from, to solana.PublicKey
+		if from, err = accountKey(keys, transferInst.Accounts[0]); err != nil {
+			return
 		}
-
-		if systemInstructionType != SystemInstructionTransfer {
-			err = errors.New(fmt.Sprintf("wrong system transfer instruction %d", systemInstructionType))
-			return op, err
+		if to, err = accountKey(keys, transferInst.Accounts[1]); err != nil {
+			return
 		}
-
-		op.From = tx.Message.AccountKeys[tx.Message.Instructions[systemTransferProgramInstructionIndexes[0]].Accounts[0]].String()
-		op.To = tx.Message.AccountKeys[tx.Message.Instructions[systemTransferProgramInstructionIndexes[0]].Accounts[1]].String()
+		op.From = from.String()
+		op.To = to.String()
 		op.Value = uint256.NewInt(value)
 	} else {
-		op.From = tx.Message.AccountKeys[tx.Message.Instructions[memoProgramInstructionIndexes[0]].Accounts[0]].String()
+		from, keyErr := accountKey(keys, memoInst.Accounts[0])
+		if keyErr != nil {
+			err = keyErr
+			return
+		}
+		op.From = from.String()
 		op.To = memoProgramId.String()
 		op.Value = uint256.NewInt(0)
 	}
 
+	// a transfer moves the tokens to the memo's recipient, not to whom the
+	// SOL goes, the transfer rule checks it's an address
+	if op.M.Op == types.OpTransfer && op.M.To != "" {
+		op.To = op.M.To
+	}
+
 	op.TxHash = tx.Signatures[0].String()
 
 	return op, nil
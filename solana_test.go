@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/require"
+
+	"sol_block_extractord/config"
+	"sol_block_extractord/filters"
+	"sol_block_extractord/finished_block_manager"
+	"sol_block_extractord/ledger"
+	"sol_block_extractord/sink"
+	"sol_block_extractord/source"
+	"sol_block_extractord/types"
+)
+
+func emptyBlock(parent uint64, hash string) *rpc.GetBlockResult {
+	height, at := parent, solana.UnixTimeSeconds(1700000000)
+	return &rpc.GetBlockResult{ParentSlot: parent, BlockHeight: &height, BlockTime: &at, Blockhash: solana.MustHashFromBase58(hash)}
+}
+
+// TestSyncRange checks the blocks fetched concurrently are committed in slot
+// order, the skipped slots left out.
+func TestSyncRange(t *testing.T) {
+	src := source.NewMemory()
+	src.Add(10, emptyBlock(9, "EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG"))
+	src.Add(12, emptyBlock(10, "11111111111111111111111111111111"))
+	src.Add(13, emptyBlock(12, "EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG"))
+	src.Add(16, emptyBlock(13, "11111111111111111111111111111111"))
+
+	tracker := finished_block_manager.NewMemoryTracker(10)
+	opsCh := make(chan sink.Block, 10)
+	require.NoError(t, syncRange(context.Background(), src, 10, 15, 3, tracker, opsCh, make(chan struct{})))
+	close(opsCh)
+
+	var slots []uint64
+	for b := range opsCh {
+		slots = append(slots, b.Slot)
+		require.Empty(t, b.Ops)
+	}
+	require.Equal(t, []uint64{10, 12, 13}, slots)
+	require.Equal(t, uint64(13), tracker.Get())
+}
+
+// memoTx is a tx of from carrying memo as its only instruction, signed by
+// the accounts.
+func memoTx(t *testing.T, from solana.PublicKey, memo string, accounts ...uint16) *rpc.TransactionWithMeta {
+	if accounts == nil {
+		accounts = []uint16{0}
+	}
+	data := base58.Encode([]byte(base64.StdEncoding.EncodeToString([]byte(memo))))
+	tx := &solana.Transaction{Signatures: []solana.Signature{{byte(len(memo))}}, Message: solana.Message{
+		Header:       solana.MessageHeader{NumRequiredSignatures: 1, NumReadonlyUnsignedAccounts: 1},
+		AccountKeys:  []solana.PublicKey{from, memoProgramId},
+		Instructions: []solana.CompiledInstruction{{ProgramIDIndex: 1, Accounts: accounts, Data: []byte(data)}},
+	}}
+	bin, err := tx.MarshalBinary()
+	require.NoError(t, err)
+	return &rpc.TransactionWithMeta{Transaction: rpc.DataBytesOrJSONFromBytes(bin), Meta: &rpc.TransactionMeta{}}
+}
+
+// TestParseTxTransfer checks a transfer credits the recipient of the memo.
+func TestParseTxTransfer(t *testing.T) {
+	config.Cfg.Biz = config.Business{FreeMint: true, Ins: config.Inscription{P: "test-20", Tick: "TEST"}}
+	defer func() { config.Cfg.Biz = config.Business{} }()
+	sender, recipient := solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()
+
+	state := ledger.New()
+	mint, err := ParseTx(2, 0, memoTx(t, sender, `data:,{"p":"test-20","op":"mint","tick":"TEST","amt":"100"}`), types.ParseMemo)
+	require.NoError(t, err)
+	state.Apply(mint)
+
+	transfer, err := ParseTx(3, 0, memoTx(t, sender, `data:,{"p":"test-20","op":"transfer","tick":"TEST","amt":"40","to":"`+recipient.String()+`"}`), types.ParseMemo)
+	require.NoError(t, err)
+	require.Equal(t, recipient.String(), transfer.To)
+	pass, reason := state.Check(transfer)
+	require.True(t, pass, reason)
+	state.Apply(transfer)
+
+	require.Equal(t, int64(60), state.Balance(sender.String()))
+	require.Equal(t, int64(40), state.Balance(recipient.String()))
+	require.Equal(t, int64(0), state.Balance(memoProgramId.String()))
+
+	// the transfer rule rejects a memo without recipient
+	noRecipient, err := ParseTx(4, 0, memoTx(t, sender, `data:,{"p":"test-20","op":"transfer","tick":"TEST","amt":"40"}`), types.ParseMemo)
+	require.NoError(t, err)
+	pass, reason = filters.FilterOperation(noRecipient, state)
+	require.False(t, pass)
+	require.Equal(t, filters.ReasonWrongRecipient, reason)
+}
+
+// TestParseTxMemoWithoutAccounts checks a memo instruction nobody signed is
+// skipped rather than crashing the worker.
+func TestParseTxMemoWithoutAccounts(t *testing.T) {
+	config.Cfg.Biz = config.Business{FreeMint: true, Ins: config.Inscription{P: "test-20", Tick: "TEST"}}
+	defer func() { config.Cfg.Biz = config.Business{} }()
+
+	_, err := ParseTx(2, 0, memoTx(t, solana.NewWallet().PublicKey(), `data:,{"p":"test-20","op":"mint","tick":"TEST","amt":"100"}`, []uint16{}...), types.ParseMemo)
+	require.EqualError(t, err, "memo instruction without signer")
+}
+
+// v0MemoTx is a v0 tx whose memo is signed by the first account its lookup
+// table loads, loaded being the accounts its meta reports.
+func v0MemoTx(t *testing.T, memo string, loaded []solana.PublicKey) *rpc.TransactionWithMeta {
+	data := base58.Encode([]byte(base64.StdEncoding.EncodeToString([]byte(memo))))
+	tx := &solana.Transaction{Signatures: []solana.Signature{{byte(len(memo))}}, Message: solana.Message{
+		Header:       solana.MessageHeader{NumRequiredSignatures: 1, NumReadonlyUnsignedAccounts: 1},
+		AccountKeys:  []solana.PublicKey{solana.NewWallet().PublicKey(), memoProgramId},
+		Instructions: []solana.CompiledInstruction{{ProgramIDIndex: 1, Accounts: []uint16{2}, Data: []byte(data)}},
+	}}
+	tx.Message.SetVersion(solana.MessageVersionV0)
+	tx.Message.AddAddressTableLookup(solana.MessageAddressTableLookup{AccountKey: solana.NewWallet().PublicKey(), WritableIndexes: []uint8{0}, ReadonlyIndexes: []uint8{}})
+	bin, err := tx.MarshalBinary()
+	require.NoError(t, err)
+	meta := &rpc.TransactionMeta{}
+	meta.LoadedAddresses.Writable = loaded
+	return &rpc.TransactionWithMeta{Transaction: rpc.DataBytesOrJSONFromBytes(bin), Meta: meta}
+}
+
+// TestParseTxV0 checks the account indexes of a v0 tx past its static keys
+// are resolved with the addresses its lookup tables loaded, and an index
+// nothing resolves is an error rather than a panic.
+func TestParseTxV0(t *testing.T) {
+	config.Cfg.Biz = config.Business{FreeMint: true, Ins: config.Inscription{P: "test-20", Tick: "TEST"}}
+	defer func() { config.Cfg.Biz = config.Business{} }()
+	memo := `data:,{"p":"test-20","op":"mint","tick":"TEST","amt":"100"}`
+	minter := solana.NewWallet().PublicKey()
+
+	op, err := ParseTx(2, 0, v0MemoTx(t, memo, []solana.PublicKey{minter}), types.ParseMemo)
+	require.NoError(t, err)
+	require.Equal(t, minter.String(), op.From)
+
+	_, err = ParseTx(2, 0, v0MemoTx(t, memo, nil), types.ParseMemo)
+	require.ErrorIs(t, err, errDecodeTx)
+	require.ErrorContains(t, err, "account index 2 out of 2 keys")
+}
@@ -0,0 +1,52 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go/rpc"
+
+	"sol_block_extractord/fixture"
+)
+
+// File replays the blocks captured in a directory, whatever the commitment.
+type File struct {
+	dir string
+}
+
+var _ BlockSource = (*File)(nil)
+
+func NewFile(dir string) *File {
+	return &File{dir: dir}
+}
+
+func (s *File) Block(ctx context.Context, slot uint64, commitment rpc.CommitmentType) (*rpc.GetBlockResult, error) {
+	return fixture.Load(s.dir, slot)
+}
+
+// Head is the last slot captured.
+func (s *File) Head(ctx context.Context, commitment rpc.CommitmentType) (uint64, error) {
+	slots, err := fixture.Slots(s.dir)
+	if err != nil {
+		return 0, err
+	}
+	if len(slots) == 0 {
+		return 0, fmt.Errorf("no block captured in %s", s.dir)
+	}
+	return slots[len(slots)-1], nil
+}
+
+// Slots are the slots captured, the skipped ones included.
+func (s *File) Slots(ctx context.Context, from, to uint64, commitment rpc.CommitmentType) ([]uint64, error) {
+	all, err := fixture.Slots(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var slots []uint64
+	for _, slot := range all {
+		if slot >= from && slot <= to {
+			slots = append(slots, slot)
+		}
+	}
+	return slots, nil
+}
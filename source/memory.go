@@ -0,0 +1,65 @@
+package source
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// Memory serves the blocks added to it, whatever the commitment.
+type Memory struct {
+	mu     sync.Mutex
+	head   uint64
+	blocks map[uint64]*rpc.GetBlockResult
+}
+
+var _ BlockSource = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{blocks: make(map[uint64]*rpc.GetBlockResult)}
+}
+
+// Add produces b at slot, and moves the head up to it.
+func (s *Memory) Add(slot uint64, b *rpc.GetBlockResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocks[slot] = b
+	if slot > s.head {
+		s.head = slot
+	}
+}
+
+// SetHead moves the head to slot, the slots up to it without a block are
+// skipped.
+func (s *Memory) SetHead(slot uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.head = slot
+}
+
+func (s *Memory) Block(ctx context.Context, slot uint64, commitment rpc.CommitmentType) (*rpc.GetBlockResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blocks[slot], nil
+}
+
+func (s *Memory) Head(ctx context.Context, commitment rpc.CommitmentType) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.head, nil
+}
+
+func (s *Memory) Slots(ctx context.Context, from, to uint64, commitment rpc.CommitmentType) ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var slots []uint64
+	for slot := range s.blocks {
+		if slot >= from && slot <= to {
+			slots = append(slots, slot)
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i] < slots[j] })
+	return slots, nil
+}
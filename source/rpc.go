@@ -0,0 +1,121 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+
+	"sol_block_extractord/metrics"
+)
+
+// RPC fetches the blocks from a JSON-RPC endpoint.
+type RPC struct {
+	cli *rpc.Client
+}
+
+var _ BlockSource = (*RPC)(nil)
+
+// NewRPC is the source of the endpoint, the local validator when empty.
+func NewRPC(endpoint string) *RPC {
+	if endpoint == "" {
+		endpoint = rpc.LocalNet_RPC
+	}
+	return &RPC{cli: rpc.New(endpoint)}
+}
+
+func (s *RPC) Block(ctx context.Context, slot uint64, commitment rpc.CommitmentType) (*rpc.GetBlockResult, error) {
+	var b *rpc.GetBlockResult
+	skipped, err := s.getBlock(ctx, slot, commitment, rpc.TransactionDetailsFull, &b)
+	if err == nil && !skipped && b == nil {
+		err = fmt.Errorf("getBlock %d returned no block", slot)
+	}
+	return b, err
+}
+
+// RawBlock is the block at slot and commitment as the endpoint returns it,
+// nil when no block was produced at the slot.
+func (s *RPC) RawBlock(ctx context.Context, slot uint64, commitment rpc.CommitmentType) (json.RawMessage, error) {
+	var b json.RawMessage
+	skipped, err := s.getBlock(ctx, slot, commitment, rpc.TransactionDetailsFull, &b)
+	if err == nil && !skipped && (len(b) == 0 || bytes.Equal(b, []byte("null"))) {
+		err = fmt.Errorf("getBlock %d returned no block", slot)
+	}
+	return b, err
+}
+
+// Hash is the hash of the block at slot and commitment, empty when no block
+// was produced at the slot.
+func (s *RPC) Hash(ctx context.Context, slot uint64, commitment rpc.CommitmentType) (string, error) {
+	var b *rpc.GetBlockResult
+	skipped, err := s.getBlock(ctx, slot, commitment, rpc.TransactionDetailsNone, &b)
+	if err != nil || skipped {
+		return "", err
+	}
+	if b == nil {
+		return "", fmt.Errorf("getBlock %d returned no block", slot)
+	}
+	return b.Blockhash.String(), nil
+}
+
+// getBlock decodes the block at slot into out, unless no block was produced
+// at the slot.
+func (s *RPC) getBlock(ctx context.Context, slot uint64, commitment rpc.CommitmentType, details rpc.TransactionDetailsType, out interface{}) (skipped bool, err error) {
+	err = s.cli.RPCCallForInto(ctx, out, "getBlock", []interface{}{slot, rpc.M{
+		"encoding":           solana.EncodingBase64,
+		"commitment":         commitment,
+		"transactionDetails": details,
+		"rewards":            false,
+	}})
+	if isSkipped(err) {
+		return true, nil
+	}
+	if err != nil {
+		metrics.RPCErrors.WithLabelValues("getBlock", errorCode(err)).Inc()
+	}
+	return false, err
+}
+
+func (s *RPC) Head(ctx context.Context, commitment rpc.CommitmentType) (uint64, error) {
+	head, err := s.cli.GetSlot(ctx, commitment)
+	if err != nil {
+		metrics.RPCErrors.WithLabelValues("getSlot", errorCode(err)).Inc()
+	}
+	return head, err
+}
+
+// Slots lists the produced slots, from to to must span at most 500000 slots.
+func (s *RPC) Slots(ctx context.Context, from, to uint64, commitment rpc.CommitmentType) ([]uint64, error) {
+	slots, err := s.cli.GetBlocks(ctx, from, &to, commitment)
+	if err != nil {
+		metrics.RPCErrors.WithLabelValues("getBlocks", errorCode(err)).Inc()
+	}
+	return slots, err
+}
+
+// Health fails when the endpoint isn't healthy.
+func (s *RPC) Health(ctx context.Context) error {
+	_, err := s.cli.GetHealth(ctx)
+	return err
+}
+
+// isSkipped reports whether err means no block was produced at the slot.
+func isSkipped(err error) bool {
+	var rpcError *jsonrpc.RPCError
+	return errors.As(err, &rpcError) && (rpcError.Code == -32007 || rpcError.Code == -32009)
+}
+
+// errorCode is the JSON-RPC error code of err, transport when it has none.
+func errorCode(err error) string {
+	var rpcError *jsonrpc.RPCError
+	if errors.As(err, &rpcError) {
+		return strconv.Itoa(rpcError.Code)
+	}
+	return "transport"
+}
@@ -0,0 +1,305 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+
+	"sol_block_extractord/metrics"
+)
+
+// signaturesPage is the most signatures getSignaturesForAddress returns.
+const signaturesPage = 1000
+
+// Cursors keeps the newest signature scanned of each account along with its
+// slot, the next scan pages back to it rather than to its first slot.
+type Cursors interface {
+	Cursor(account solana.PublicKey) (sig solana.Signature, slot uint64, err error)
+	SetCursor(account solana.PublicKey, sig solana.Signature, slot uint64) error
+}
+
+// MemoryCursors keeps the cursors until the process exits.
+type MemoryCursors struct {
+	mu      sync.Mutex
+	cursors map[solana.PublicKey]rpc.TransactionSignature
+}
+
+var _ Cursors = (*MemoryCursors)(nil)
+
+func NewMemoryCursors() *MemoryCursors {
+	return &MemoryCursors{cursors: make(map[solana.PublicKey]rpc.TransactionSignature)}
+}
+
+func (c *MemoryCursors) Cursor(account solana.PublicKey) (solana.Signature, uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cursor := c.cursors[account]
+	return cursor.Signature, cursor.Slot, nil
+}
+
+func (c *MemoryCursors) SetCursor(account solana.PublicKey, sig solana.Signature, slot uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cursors[account] = rpc.TransactionSignature{Signature: sig, Slot: slot}
+	return nil
+}
+
+// Signatures finds the finalized transactions of some accounts with
+// getSignaturesForAddress, and fetches them alone with getTransaction rather
+// than their whole block.
+type Signatures struct {
+	rpc      *RPC
+	accounts []solana.PublicKey
+	workers  int
+	cursors  Cursors
+}
+
+// NewSignatures scans the accounts on src, with workers concurrent
+// getTransaction calls. The cursors are kept in memory when nil.
+func NewSignatures(src *RPC, accounts []solana.PublicKey, workers int, cursors Cursors) *Signatures {
+	if workers < 1 {
+		workers = 1
+	}
+	if cursors == nil {
+		cursors = NewMemoryCursors()
+	}
+	return &Signatures{rpc: src, accounts: accounts, workers: workers, cursors: cursors}
+}
+
+// Scan hands fn the slots from to to with successful transactions of the
+// accounts in order, with their signatures, and stops at the first error fn
+// returns. The signatures of an account are paged back to its cursor, or to
+// from when the cursor isn't older, keeping the page bounds only, then the
+// pages are fetched again from the oldest on: a long range isn't kept in
+// memory whole. The cursors move once fn has been given every slot.
+func (s *Signatures) Scan(ctx context.Context, from, to uint64, fn func(slot uint64, sigs []solana.Signature) error) error {
+	streams := make([]*signatureStream, len(s.accounts))
+	for i, account := range s.accounts {
+		var err error
+		if streams[i], err = s.stream(ctx, account, from, to); err != nil {
+			return err
+		}
+	}
+
+	for {
+		// the lowest slot the streams are at, its signatures in every stream
+		var slot uint64
+		found := false
+		for _, st := range streams {
+			sig, ok, err := st.peek(ctx)
+			if err != nil {
+				return err
+			}
+			if ok && (!found || sig.Slot < slot) {
+				slot, found = sig.Slot, true
+			}
+		}
+		if !found {
+			break
+		}
+
+		var sigs []solana.Signature
+		seen := make(map[solana.Signature]bool)
+		for _, st := range streams {
+			for {
+				sig, ok, err := st.peek(ctx)
+				if err != nil {
+					return err
+				}
+				if !ok || sig.Slot != slot {
+					break
+				}
+				st.page = st.page[1:]
+				if !seen[sig.Signature] {
+					seen[sig.Signature] = true
+					sigs = append(sigs, sig.Signature)
+				}
+			}
+		}
+		if err := fn(slot, sigs); err != nil {
+			return err
+		}
+	}
+
+	for _, st := range streams {
+		if st.latest == nil {
+			continue
+		}
+		if err := s.cursors.SetCursor(st.account, st.latest.Signature, st.latest.Slot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// signatureStream is the successful signatures of an account from from to to,
+// oldest first.
+type signatureStream struct {
+	s        *Signatures
+	account  solana.PublicKey
+	from, to uint64
+	until    solana.Signature
+
+	befores []solana.Signature          // the bounds of the older pages left to fetch, the oldest last
+	newest  []*rpc.TransactionSignature // the newest page, kept from the walk back as it may have grown since
+	page    []*rpc.TransactionSignature // what's left of the current page, oldest first
+	latest  *rpc.TransactionSignature   // the newest signature up to to, the next cursor
+}
+
+// stream pages the signatures of account back to its cursor or to from,
+// keeping the bounds of the pages.
+func (s *Signatures) stream(ctx context.Context, account solana.PublicKey, from, to uint64) (*signatureStream, error) {
+	st := &signatureStream{s: s, account: account, from: from, to: to}
+	cursor, cursorSlot, err := s.cursors.Cursor(account)
+	if err != nil {
+		return nil, err
+	}
+	// the signatures past the cursor only cover from on when it's older
+	if !cursor.IsZero() && cursorSlot < from {
+		st.until = cursor
+	}
+
+	var before solana.Signature
+	for {
+		page, err := s.signatures(ctx, account, before, st.until)
+		if err != nil {
+			return nil, err
+		}
+		for _, sig := range page {
+			if st.latest == nil && sig.Slot <= to {
+				st.latest = sig
+			}
+		}
+		if before.IsZero() {
+			st.newest = page
+		} else {
+			st.befores = append(st.befores, before)
+		}
+		if len(page) < signaturesPage || page[len(page)-1].Slot < from {
+			break
+		}
+		before = page[len(page)-1].Signature
+	}
+	return st, nil
+}
+
+// peek is the oldest signature left, fetching the next page when the current
+// one is done.
+func (st *signatureStream) peek(ctx context.Context) (*rpc.TransactionSignature, bool, error) {
+	for len(st.page) == 0 {
+		var page []*rpc.TransactionSignature
+		switch {
+		case len(st.befores) != 0:
+			before := st.befores[len(st.befores)-1]
+			st.befores = st.befores[:len(st.befores)-1]
+			var err error
+			if page, err = st.s.signatures(ctx, st.account, before, st.until); err != nil {
+				return nil, false, err
+			}
+		case st.newest != nil:
+			page, st.newest = st.newest, nil
+		default:
+			return nil, false, nil
+		}
+
+		for i := len(page) - 1; i >= 0; i-- {
+			sig := page[i]
+			if sig.Slot >= st.from && sig.Slot <= st.to && sig.Err == nil {
+				st.page = append(st.page, sig)
+			}
+		}
+	}
+	return st.page[0], true, nil
+}
+
+// signatures is the page of the signatures of account before before, down to
+// until, newest first.
+func (s *Signatures) signatures(ctx context.Context, account solana.PublicKey, before, until solana.Signature) ([]*rpc.TransactionSignature, error) {
+	limit := signaturesPage
+	page, err := s.rpc.cli.GetSignaturesForAddressWithOpts(ctx, account, &rpc.GetSignaturesForAddressOpts{Limit: &limit, Before: before, Until: until, Commitment: rpc.CommitmentFinalized})
+	if err != nil {
+		metrics.RPCErrors.WithLabelValues("getSignaturesForAddress", errorCode(err)).Inc()
+	}
+	return page, err
+}
+
+// Block is the finalized block at slot with the transactions sigs only, in the
+// block order, along with their index in the block.
+func (s *Signatures) Block(ctx context.Context, slot uint64, sigs []solana.Signature) (*rpc.GetBlockResult, []int, error) {
+	var b *rpc.GetBlockResult
+	skipped, err := s.rpc.getBlock(ctx, slot, rpc.CommitmentFinalized, rpc.TransactionDetailsSignatures, &b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if skipped || b == nil {
+		return nil, nil, fmt.Errorf("finalized block %d not available", slot)
+	}
+
+	index := make(map[solana.Signature]int, len(b.Signatures))
+	for i, sig := range b.Signatures {
+		index[sig] = i
+	}
+	sigs = append([]solana.Signature(nil), sigs...)
+	for _, sig := range sigs {
+		if _, ok := index[sig]; !ok {
+			return nil, nil, fmt.Errorf("transaction %s not in block %d", sig, slot)
+		}
+	}
+	sort.Slice(sigs, func(i, j int) bool { return index[sigs[i]] < index[sigs[j]] })
+
+	b.Signatures = nil
+	b.Transactions = make([]rpc.TransactionWithMeta, len(sigs))
+	indexes := make([]int, len(sigs))
+	errs := make([]error, len(sigs))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < s.workers && w < len(sigs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				indexes[i] = index[sigs[i]]
+				b.Transactions[i], errs[i] = s.transaction(ctx, sigs[i], slot)
+			}
+		}()
+	}
+	for i := range sigs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return b, indexes, nil
+}
+
+// transaction fetches the transaction sig of the block at slot.
+func (s *Signatures) transaction(ctx context.Context, sig solana.Signature, slot uint64) (rpc.TransactionWithMeta, error) {
+	maxVersion := uint64(0)
+	r, err := s.rpc.cli.GetTransaction(ctx, sig, &rpc.GetTransactionOpts{
+		Encoding:                       solana.EncodingBase64,
+		Commitment:                     rpc.CommitmentFinalized,
+		MaxSupportedTransactionVersion: &maxVersion,
+	})
+	if err != nil {
+		metrics.RPCErrors.WithLabelValues("getTransaction", errorCode(err)).Inc()
+		return rpc.TransactionWithMeta{}, err
+	}
+	if r == nil || r.Transaction == nil {
+		return rpc.TransactionWithMeta{}, fmt.Errorf("transaction %s of block %d not available", sig, slot)
+	}
+	return rpc.TransactionWithMeta{
+		Slot:        r.Slot,
+		BlockTime:   r.BlockTime,
+		Transaction: rpc.DataBytesOrJSONFromBytes(r.Transaction.GetBinary()),
+		Meta:        r.Meta,
+		Version:     r.Version,
+	}, nil
+}
@@ -0,0 +1,217 @@
+package source
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+var memoProgram = solana.MustPublicKeyFromBase58("MemoSq4gqABAXKb96qnH8TysNcWxMyWCqXgDLGmfcHr")
+
+func signature(n uint64) solana.Signature {
+	var sig solana.Signature
+	binary.BigEndian.PutUint64(sig[:], n+1)
+	return sig
+}
+
+type entry struct {
+	Signature solana.Signature `json:"signature"`
+	Slot      uint64           `json:"slot"`
+	Err       interface{}      `json:"err"`
+}
+
+// ledger answers getSignaturesForAddress from the entries of the accounts,
+// latest first, and getBlock and getTransaction from the signatures of the
+// blocks. The transactions of v0 are v0, their memo signed by the account
+// their lookup table loads. calls counts the getSignaturesForAddress calls.
+func ledger(t *testing.T, accounts map[string][]entry, blocks map[uint64][]solana.Signature, v0 map[solana.Signature]solana.PublicKey, calls *int) func(method string, params []json.RawMessage) (interface{}, rpcError) {
+	return func(method string, params []json.RawMessage) (interface{}, rpcError) {
+		switch method {
+		case "getSignaturesForAddress":
+			*calls++
+			var account string
+			var opts struct {
+				Limit  int              `json:"limit"`
+				Before solana.Signature `json:"before"`
+				Until  solana.Signature `json:"until"`
+			}
+			require.NoError(t, json.Unmarshal(params[0], &account))
+			require.NoError(t, json.Unmarshal(params[1], &opts))
+			entries := accounts[account]
+			if !opts.Before.IsZero() {
+				for i, e := range entries {
+					if e.Signature == opts.Before {
+						entries = entries[i+1:]
+						break
+					}
+				}
+			}
+			if !opts.Until.IsZero() {
+				for i, e := range entries {
+					if e.Signature == opts.Until {
+						entries = entries[:i]
+						break
+					}
+				}
+			}
+			if len(entries) > opts.Limit {
+				entries = entries[:opts.Limit]
+			}
+			return entries, rpcError{}
+
+		case "getBlock":
+			var slot uint64
+			var opts struct {
+				TransactionDetails string `json:"transactionDetails"`
+			}
+			require.NoError(t, json.Unmarshal(params[0], &slot))
+			require.NoError(t, json.Unmarshal(params[1], &opts))
+			require.Equal(t, "signatures", opts.TransactionDetails)
+			return map[string]interface{}{
+				"blockHeight": slot - 10, "blockTime": 1700000000, "parentSlot": slot - 1,
+				"blockhash": "EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG", "previousBlockhash": "11111111111111111111111111111111",
+				"signatures": blocks[slot],
+			}, rpcError{}
+
+		case "getTransaction":
+			var sig solana.Signature
+			require.NoError(t, json.Unmarshal(params[0], &sig))
+			tx := &solana.Transaction{Signatures: []solana.Signature{sig}, Message: solana.Message{
+				Header:       solana.MessageHeader{NumRequiredSignatures: 1, NumReadonlyUnsignedAccounts: 1},
+				AccountKeys:  []solana.PublicKey{solana.NewWallet().PublicKey(), memoProgram},
+				Instructions: []solana.CompiledInstruction{{ProgramIDIndex: 1, Accounts: []uint16{0}, Data: []byte("memo")}},
+			}}
+			version := interface{}("legacy")
+			meta := map[string]interface{}{"err": nil, "fee": 5000, "preBalances": []uint64{}, "postBalances": []uint64{}}
+			if signer, ok := v0[sig]; ok {
+				version = 0
+				tx.Message.SetVersion(solana.MessageVersionV0)
+				tx.Message.AddAddressTableLookup(solana.MessageAddressTableLookup{AccountKey: solana.NewWallet().PublicKey(), WritableIndexes: []uint8{0}, ReadonlyIndexes: []uint8{}})
+				tx.Message.Instructions[0].Accounts = []uint16{2}
+				meta["loadedAddresses"] = map[string]interface{}{"writable": []string{signer.String()}, "readonly": []string{}}
+			}
+			data, err := tx.MarshalBinary()
+			require.NoError(t, err)
+			return map[string]interface{}{
+				"slot": 100, "blockTime": 1700000000, "version": version,
+				"transaction": []string{base64.StdEncoding.EncodeToString(data), "base64"},
+				"meta":        meta,
+			}, rpcError{}
+		}
+		return nil, rpcError{Code: -32601, Message: "Method not found"}
+	}
+}
+
+// scan is what Scan hands over, the slots in order and their signatures.
+func scan(t *testing.T, s *Signatures, from, to uint64) (slots []uint64, bySlot map[uint64][]solana.Signature) {
+	bySlot = make(map[uint64][]solana.Signature)
+	require.NoError(t, s.Scan(context.Background(), from, to, func(slot uint64, sigs []solana.Signature) error {
+		slots = append(slots, slot)
+		bySlot[slot] = sigs
+		return nil
+	}))
+	return
+}
+
+func TestSignatures(t *testing.T) {
+	treasury := solana.NewWallet().PublicKey()
+	memo := []entry{{Signature: signature(10), Slot: 103}, {Signature: signature(21), Slot: 102}, {Signature: signature(20), Slot: 102}}
+	for n := uint64(0); n < 998; n++ {
+		memo = append(memo, entry{Signature: signature(1000 + n), Slot: 101})
+	}
+	memo = append(memo,
+		entry{Signature: signature(3), Slot: 100, Err: map[string]interface{}{"InstructionError": []interface{}{0, "Custom"}}},
+		entry{Signature: signature(2), Slot: 100},
+		entry{Signature: signature(0), Slot: 100},
+		entry{Signature: signature(99), Slot: 99},
+	)
+	accounts := map[string][]entry{
+		memoProgram.String(): memo,
+		treasury.String():    {{Signature: signature(20), Slot: 102}, {Signature: signature(1), Slot: 100}},
+	}
+	var calls int
+	server := serve(t, ledger(t, accounts,
+		map[uint64][]solana.Signature{100: {signature(0), signature(1), signature(2), signature(3)}, 102: {signature(20), signature(21)}},
+		nil, &calls,
+	))
+	defer server.Close()
+	cursors := NewMemoryCursors()
+	s := NewSignatures(NewRPC(server.URL), []solana.PublicKey{memoProgram, treasury}, 2, cursors)
+	ctx := context.Background()
+
+	slots, bySlot := scan(t, s, 100, 102)
+	require.Equal(t, []uint64{100, 101, 102}, slots)
+	require.ElementsMatch(t, []solana.Signature{signature(0), signature(1), signature(2)}, bySlot[100])
+	require.Len(t, bySlot[101], 998)
+	require.Equal(t, []solana.Signature{signature(20), signature(21)}, bySlot[102])
+	// the older page of the memo program is fetched again, oldest first
+	require.Equal(t, 4, calls)
+	block100 := bySlot[100]
+
+	sig, slot, err := cursors.Cursor(memoProgram)
+	require.NoError(t, err)
+	require.Equal(t, signature(21), sig)
+	require.Equal(t, uint64(102), slot)
+
+	// the next scan only pages back to the cursors
+	accounts[memoProgram.String()] = append([]entry{{Signature: signature(30), Slot: 104}}, memo...)
+	calls = 0
+	slots, bySlot = scan(t, s, 103, 104)
+	require.Equal(t, []uint64{103, 104}, slots)
+	require.Equal(t, []solana.Signature{signature(10)}, bySlot[103])
+	require.Equal(t, []solana.Signature{signature(30)}, bySlot[104])
+	require.Equal(t, 2, calls)
+
+	// the cursors stay when fn stops the scan
+	stop := errors.New("stop")
+	accounts[memoProgram.String()] = append([]entry{{Signature: signature(40), Slot: 105}}, accounts[memoProgram.String()]...)
+	require.ErrorIs(t, s.Scan(ctx, 105, 105, func(uint64, []solana.Signature) error { return stop }), stop)
+	sig, _, err = cursors.Cursor(memoProgram)
+	require.NoError(t, err)
+	require.Equal(t, signature(30), sig)
+
+	b, indexes, err := s.Block(ctx, 100, block100)
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1, 2}, indexes)
+	require.Equal(t, uint64(90), *b.BlockHeight)
+	require.Nil(t, b.Signatures)
+	require.Len(t, b.Transactions, 3)
+	for i, tx := range b.Transactions {
+		decoded, err := tx.GetTransaction()
+		require.NoError(t, err)
+		require.Equal(t, signature(uint64(i)), decoded.Signatures[0])
+		require.Nil(t, tx.Meta.Err)
+	}
+
+	_, _, err = s.Block(ctx, 102, []solana.Signature{signature(22)})
+	require.ErrorContains(t, err, "not in block 102")
+}
+
+// TestSignaturesV0 checks a v0 transaction comes with the addresses its lookup
+// tables loaded, what its account indexes past the static keys point to.
+func TestSignaturesV0(t *testing.T) {
+	signer := solana.NewWallet().PublicKey()
+	var calls int
+	server := serve(t, ledger(t, nil,
+		map[uint64][]solana.Signature{100: {signature(0)}},
+		map[solana.Signature]solana.PublicKey{signature(0): signer}, &calls,
+	))
+	defer server.Close()
+	s := NewSignatures(NewRPC(server.URL), []solana.PublicKey{memoProgram}, 1, nil)
+
+	b, _, err := s.Block(context.Background(), 100, []solana.Signature{signature(0)})
+	require.NoError(t, err)
+	tx := b.Transactions[0]
+	decoded, err := tx.GetTransaction()
+	require.NoError(t, err)
+	require.Equal(t, solana.MessageVersionV0, decoded.Message.GetVersion())
+	require.Equal(t, []uint16{2}, decoded.Message.Instructions[0].Accounts)
+	require.Equal(t, solana.PublicKeySlice{signer}, tx.Meta.LoadedAddresses.Writable)
+	require.Empty(t, tx.Meta.LoadedAddresses.ReadOnly)
+}
@@ -0,0 +1,18 @@
+package source
+
+import (
+	"context"
+
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// BlockSource is where the blocks are fetched from.
+type BlockSource interface {
+	// Block is the block at slot and commitment, nil when no block was
+	// produced at the slot.
+	Block(ctx context.Context, slot uint64, commitment rpc.CommitmentType) (*rpc.GetBlockResult, error)
+	// Head is the latest slot at commitment.
+	Head(ctx context.Context, commitment rpc.CommitmentType) (uint64, error)
+	// Slots are the slots from to to which may have a block, in order.
+	Slots(ctx context.Context, from, to uint64, commitment rpc.CommitmentType) ([]uint64, error)
+}
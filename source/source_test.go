@@ -0,0 +1,149 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/require"
+
+	"sol_block_extractord/fixture"
+)
+
+const block = `{"blockHeight":90,"blockTime":1700000000,"blockhash":"EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG","parentSlot":99,"previousBlockhash":"11111111111111111111111111111111","transactions":[]}`
+
+// rpcError is a JSON-RPC error, its code 0 when the call succeeded.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// serve answers the JSON-RPC calls with handle.
+func serve(t *testing.T, handle func(method string, params []json.RawMessage) (interface{}, rpcError)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		if result, e := handle(req.Method, req.Params); e.Code != 0 {
+			resp["error"] = e
+		} else {
+			resp["result"] = result
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+}
+
+// node answers getSlot, getBlocks and getBlock, slot 101 was skipped.
+func node(t *testing.T) *httptest.Server {
+	return serve(t, func(method string, params []json.RawMessage) (interface{}, rpcError) {
+		switch method {
+		case "getSlot":
+			return 102, rpcError{}
+		case "getBlocks":
+			return []uint64{100, 102}, rpcError{}
+		case "getBlock":
+			if string(params[0]) == "101" {
+				return nil, rpcError{Code: -32007, Message: "Slot 101 was skipped"}
+			}
+			return json.RawMessage(block), rpcError{}
+		}
+		return nil, rpcError{Code: -32601, Message: "Method not found"}
+	})
+}
+
+func TestRPC(t *testing.T) {
+	server := node(t)
+	defer server.Close()
+	s := NewRPC(server.URL)
+	ctx := context.Background()
+
+	head, err := s.Head(ctx, rpc.CommitmentConfirmed)
+	require.NoError(t, err)
+	require.Equal(t, uint64(102), head)
+
+	slots, err := s.Slots(ctx, 100, 102, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{100, 102}, slots)
+
+	b, err := s.Block(ctx, 100, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.Equal(t, uint64(99), b.ParentSlot)
+	hash, err := s.Hash(ctx, 100, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.Equal(t, "EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG", hash)
+	raw, err := s.RawBlock(ctx, 100, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.JSONEq(t, block, string(raw))
+
+	b, err = s.Block(ctx, 101, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.Nil(t, b)
+	hash, err = s.Hash(ctx, 101, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.Empty(t, hash)
+	raw, err = s.RawBlock(ctx, 101, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.Nil(t, raw)
+
+	require.Error(t, s.Health(ctx))
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, fixture.Save(dir, 100, json.RawMessage(block)))
+	require.NoError(t, fixture.Save(dir, 101, nil))
+	require.NoError(t, fixture.Save(dir, 105, json.RawMessage(block)))
+	s := NewFile(dir)
+	ctx := context.Background()
+
+	head, err := s.Head(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.Equal(t, uint64(105), head)
+
+	slots, err := s.Slots(ctx, 101, 110, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{101, 105}, slots)
+
+	b, err := s.Block(ctx, 100, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.Equal(t, uint64(90), *b.BlockHeight)
+	b, err = s.Block(ctx, 101, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.Nil(t, b)
+	_, err = s.Block(ctx, 102, rpc.CommitmentFinalized)
+	require.Error(t, err)
+
+	_, err = NewFile(t.TempDir()).Head(ctx, rpc.CommitmentFinalized)
+	require.ErrorContains(t, err, "no block captured")
+}
+
+func TestMemory(t *testing.T) {
+	s := NewMemory()
+	ctx := context.Background()
+	s.Add(12, &rpc.GetBlockResult{ParentSlot: 10})
+	s.Add(10, &rpc.GetBlockResult{ParentSlot: 9})
+	s.SetHead(14)
+
+	head, err := s.Head(ctx, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.Equal(t, uint64(14), head)
+
+	slots, err := s.Slots(ctx, 10, 14, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{10, 12}, slots)
+
+	b, err := s.Block(ctx, 12, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), b.ParentSlot)
+	b, err = s.Block(ctx, 11, rpc.CommitmentFinalized)
+	require.NoError(t, err)
+	require.Nil(t, b)
+}
@@ -0,0 +1,49 @@
+CREATE TABLE IF NOT EXISTS "Operation" (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    "from"        TEXT    NOT NULL,
+    "to"          TEXT    NOT NULL,
+    txhash        TEXT    NOT NULL,
+    "instIndex"   INTEGER NOT NULL DEFAULT 0,
+    "rawData"     TEXT    NOT NULL,
+    "blockHeight" INTEGER NOT NULL,
+    p             TEXT    NOT NULL,
+    op            TEXT    NOT NULL,
+    tick          TEXT    NOT NULL,
+    amt           TEXT    NOT NULL DEFAULT '',
+    lim           TEXT    NOT NULL DEFAULT '',
+    max           TEXT    NOT NULL DEFAULT '',
+    value         TEXT    NOT NULL,
+    timestamp     INTEGER NOT NULL,
+    "txIndex"     INTEGER NOT NULL,
+    slot          INTEGER NOT NULL DEFAULT 0,
+    "createdAt"   TEXT    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (txhash, "instIndex")
+);
+CREATE INDEX IF NOT EXISTS "Operation_blockHeight_txIndex_idx" ON "Operation" ("blockHeight", "txIndex");
+
+CREATE TABLE IF NOT EXISTS "Rejection" (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    txhash        TEXT    NOT NULL,
+    "instIndex"   INTEGER NOT NULL DEFAULT 0,
+    "blockHeight" INTEGER NOT NULL,
+    "txIndex"     INTEGER NOT NULL,
+    "from"        TEXT    NOT NULL,
+    "to"          TEXT    NOT NULL DEFAULT '',
+    op            TEXT    NOT NULL,
+    tick          TEXT    NOT NULL,
+    reason        TEXT    NOT NULL,
+    "rawData"     TEXT    NOT NULL,
+    value         TEXT    NOT NULL DEFAULT '0x0',
+    timestamp     INTEGER NOT NULL DEFAULT 0,
+    slot          INTEGER NOT NULL DEFAULT 0,
+    "createdAt"   TEXT    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (txhash, "instIndex")
+);
+
+CREATE TABLE IF NOT EXISTS "Balance" (
+    tick        TEXT    NOT NULL,
+    address     TEXT    NOT NULL,
+    amount      INTEGER NOT NULL,
+    "updatedAt" TEXT    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tick, address)
+);
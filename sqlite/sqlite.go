@@ -0,0 +1,192 @@
+package sqlite
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+
+	"github.com/holiman/uint256"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite"
+
+	"sol_block_extractord/config"
+	"sol_block_extractord/log"
+	"sol_block_extractord/sink"
+	"sol_block_extractord/types"
+)
+
+//go:embed schema.sql
+var schema string
+
+// Cli is the SQLite sink, the tables mirror the postgres ones for local
+// development and CI.
+type Cli struct {
+	db *sql.DB
+}
+
+var _ sink.Sink = (*Cli)(nil)
+
+// NewCli opens the database at path, creating it and its tables if needed.
+func NewCli(path string) (cli *Cli, err error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return
+	}
+	db.SetMaxOpenConns(1) // one writer at a time anyway
+
+	_, err = db.Exec(schema)
+	if err == nil {
+		err = upgrade(db)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sqlite %s schema err:%w", path, err)
+	}
+
+	return &Cli{db: db}, nil
+}
+
+// added are the columns of the tables created before them, with their
+// definition.
+var added = []struct{ table, column, definition string }{
+	{"Operation", "slot", "INTEGER NOT NULL DEFAULT 0"},
+	{"Rejection", "to", "TEXT NOT NULL DEFAULT ''"},
+	{"Rejection", "value", "TEXT NOT NULL DEFAULT '0x0'"},
+	{"Rejection", "timestamp", "INTEGER NOT NULL DEFAULT 0"},
+	{"Rejection", "slot", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// upgrade adds the columns missing from a database created by an older
+// schema, CREATE TABLE IF NOT EXISTS leaves its tables as they are.
+func upgrade(db *sql.DB) error {
+	for _, a := range added {
+		var n int
+		err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", a.table, a.column).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			_, err = db.Exec(fmt.Sprintf("ALTER TABLE %q ADD COLUMN %q %s", a.table, a.column, a.definition))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (cli *Cli) Write(b sink.Batch) error {
+	tx, err := cli.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tick := config.Cfg.Biz.Ins.Tick
+	if b.Replace {
+		for _, table := range []string{"Operation", "Rejection"} {
+			_, err = tx.Exec("DELETE FROM \""+table+"\" WHERE tick = ?", tick)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, op := range b.Ops {
+		res, err := tx.Exec("INSERT INTO \"Operation\"(\"from\", \"to\", txhash, \"instIndex\", \"rawData\", \"blockHeight\", p, op, tick, amt, lim, max, value, timestamp, \"txIndex\", slot) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING",
+			op.From, op.To, op.TxHash, op.InstIdx, op.MemoRaw, int64(op.BlockHeight), op.M.P, op.M.Op, op.M.Tick, op.M.Amt, op.M.Lim, op.M.Max, op.Value.String(), op.BlockTimeSec, op.TxIdx, int64(op.Slot))
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			log.Logger.Info("duplicated operation skipped", zap.Uint64("slot", op.Slot), zap.Uint64("block_height", op.BlockHeight), zap.Int("txIndex", op.TxIdx), zap.String("signature", op.TxHash))
+		}
+	}
+
+	for _, r := range b.Rejections {
+		_, err = tx.Exec("INSERT INTO \"Rejection\"(txhash, \"instIndex\", \"blockHeight\", \"txIndex\", \"from\", \"to\", op, tick, reason, \"rawData\", value, timestamp, slot) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING",
+			r.Op.TxHash, r.Op.InstIdx, int64(r.Op.BlockHeight), r.Op.TxIdx, r.Op.From, r.Op.To, r.Op.M.Op, r.Op.M.Tick, r.Reason, r.Op.MemoRaw, r.Op.Value.String(), r.Op.BlockTimeSec, int64(r.Op.Slot))
+		if err != nil {
+			return err
+		}
+	}
+
+	if b.AllBalances {
+		_, err = tx.Exec("DELETE FROM \"Balance\" WHERE tick = ?", tick)
+		if err != nil {
+			return err
+		}
+	}
+	for addr, amt := range b.Balances {
+		if amt == 0 {
+			_, err = tx.Exec("DELETE FROM \"Balance\" WHERE tick = ? AND address = ?", tick, addr)
+		} else {
+			_, err = tx.Exec("INSERT INTO \"Balance\"(tick, address, amount) VALUES(?, ?, ?) ON CONFLICT (tick, address) DO UPDATE SET amount = excluded.amount, \"updatedAt\" = CURRENT_TIMESTAMP",
+				tick, addr, amt)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// LoadOperations feeds the stored operations to fn in (height, txIdx, instIdx) order.
+func (cli *Cli) LoadOperations(fn func(op types.Operation)) error {
+	rows, err := cli.db.Query("SELECT \"from\", \"to\", txhash, \"instIndex\", \"rawData\", \"blockHeight\", p, op, tick, amt, lim, max, value, timestamp, \"txIndex\", slot FROM \"Operation\" ORDER BY \"blockHeight\", \"txIndex\", \"instIndex\"")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var op types.Operation
+		var height, timeSec, slot int64
+		var value string
+		err = rows.Scan(&op.From, &op.To, &op.TxHash, &op.InstIdx, &op.MemoRaw, &height, &op.M.P, &op.M.Op, &op.M.Tick, &op.M.Amt, &op.M.Lim, &op.M.Max, &value, &timeSec, &op.TxIdx, &slot)
+		if err != nil {
+			return err
+		}
+
+		op.Slot = uint64(slot)
+		op.Restore(uint64(height), timeSec, value)
+		fn(op)
+	}
+
+	return rows.Err()
+}
+
+// LoadRejections feeds the stored rejections to fn, the rest of their memo is
+// parsed again from the raw data.
+func (cli *Cli) LoadRejections(fn func(r sink.Rejection)) error {
+	rows, err := cli.db.Query("SELECT txhash, \"instIndex\", \"blockHeight\", \"txIndex\", \"from\", \"to\", op, tick, reason, \"rawData\", value, timestamp, slot FROM \"Rejection\"")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r sink.Rejection
+		var height, timeSec, slot int64
+		var value string
+		err = rows.Scan(&r.Op.TxHash, &r.Op.InstIdx, &height, &r.Op.TxIdx, &r.Op.From, &r.Op.To, &r.Op.M.Op, &r.Op.M.Tick, &r.Reason, &r.Op.MemoRaw, &value, &timeSec, &slot)
+		if err != nil {
+			return err
+		}
+
+		if m, err := types.ParseMemo(r.Op.MemoRaw); err == nil {
+			r.Op.M = m
+		}
+		r.Op.Slot = uint64(slot)
+		r.Op.SetupBlockInfo(uint64(height), timeSec, r.Op.TxIdx)
+		r.Op.Value, _ = uint256.FromHex(value)
+		fn(r)
+	}
+
+	return rows.Err()
+}
+
+func (cli *Cli) Close() error {
+	return cli.db.Close()
+}
@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	"sol_block_extractord/config"
+	"sol_block_extractord/sink"
+	"sol_block_extractord/types"
+)
+
+func TestWriteAndLoad(t *testing.T) {
+	config.Cfg.Biz.Ins.Tick = "TEST"
+	path := filepath.Join(t.TempDir(), "ins.db")
+	cli, err := NewCli(path)
+	require.NoError(t, err)
+
+	ops := make([]types.Operation, 2)
+	for i := range ops {
+		ops[i] = types.Operation{TxHash: string(rune('a' + i)), InstIdx: 1, From: "from", To: "to", Value: uint256.NewInt(uint64(i)), MemoRaw: "raw",
+			M: types.Memo{P: "test-20", Op: types.OpMint, Tick: "TEST", Amt: "100", AmtN: 100}}
+		ops[i].Slot = uint64(300 - i)
+		ops[i].SetupBlockInfo(uint64(200-i), 1700000000, i)
+	}
+	require.NoError(t, cli.Write(sink.Batch{Ops: ops, Balances: map[string]int64{"from": 200, "gone": 1}}))
+	// the memo of a rejection is parsed again from its raw data
+	rejected := ops[0]
+	rejected.MemoRaw = base64.StdEncoding.EncodeToString([]byte(`data:,{"p":"test-20","op":"mint","tick":"test","amt":"100"}`))
+	require.NoError(t, cli.Write(sink.Batch{Ops: ops[:1], Rejections: []sink.Rejection{{Op: rejected, Reason: "r"}}, Balances: map[string]int64{"gone": 0}}))
+	require.NoError(t, cli.Close())
+
+	cli, err = NewCli(path)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	var loaded []types.Operation
+	require.NoError(t, cli.LoadOperations(func(op types.Operation) { loaded = append(loaded, op) }))
+	require.Equal(t, []types.Operation{ops[1], ops[0]}, loaded)
+
+	var holders int
+	require.NoError(t, cli.db.QueryRow("SELECT COUNT(*) FROM \"Balance\"").Scan(&holders))
+	require.Equal(t, 1, holders)
+	var rejections []sink.Rejection
+	require.NoError(t, cli.LoadRejections(func(r sink.Rejection) { rejections = append(rejections, r) }))
+	require.Equal(t, []sink.Rejection{{Op: rejected, Reason: "r"}}, rejections)
+
+	// a merge replaces the ledger of the tick
+	require.NoError(t, cli.Write(sink.Batch{Replace: true, Ops: ops[1:], AllBalances: true}))
+	loaded = nil
+	require.NoError(t, cli.LoadOperations(func(op types.Operation) { loaded = append(loaded, op) }))
+	require.Equal(t, ops[1:], loaded)
+	rejections = nil
+	require.NoError(t, cli.LoadRejections(func(r sink.Rejection) { rejections = append(rejections, r) }))
+	require.Empty(t, rejections)
+}
+
+// TestUpgrade checks a database created before the slot of the operations
+// and the value of the rejections were kept gets the new columns.
+func TestUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ins.db")
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE \"Operation\" (id INTEGER PRIMARY KEY AUTOINCREMENT, \"from\" TEXT NOT NULL, \"to\" TEXT NOT NULL, txhash TEXT NOT NULL, \"instIndex\" INTEGER NOT NULL DEFAULT 0, \"rawData\" TEXT NOT NULL, \"blockHeight\" INTEGER NOT NULL, p TEXT NOT NULL, op TEXT NOT NULL, tick TEXT NOT NULL, amt TEXT NOT NULL DEFAULT '', lim TEXT NOT NULL DEFAULT '', max TEXT NOT NULL DEFAULT '', value TEXT NOT NULL, timestamp INTEGER NOT NULL, \"txIndex\" INTEGER NOT NULL, \"createdAt\" TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP, UNIQUE (txhash, \"instIndex\"))")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	cli, err := NewCli(path)
+	require.NoError(t, err)
+	defer cli.Close()
+	for _, a := range added {
+		var n int
+		require.NoError(t, cli.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", a.table, a.column).Scan(&n))
+		require.Equal(t, 1, n, a.table+"."+a.column)
+	}
+}
@@ -0,0 +1,96 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"sol_block_extractord/log"
+)
+
+const maxRetryBackoff = 30 * time.Second
+
+// Kafka publishes to the first partition of a topic, the messages are keyed
+// by slot and stay in the order published across slots.
+type Kafka struct {
+	w      *kafka.Writer
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewKafka writes to topic on the comma separated brokers.
+func NewKafka(brokers, topic string) *Kafka {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Kafka{w: &kafka.Writer{
+		Addr:         kafka.TCP(strings.Split(brokers, ",")...),
+		Topic:        topic,
+		Balancer:     firstPartition,
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 10 * time.Millisecond, // Publish waits for the acks anyway
+	}, ctx: ctx, cancel: cancel}
+}
+
+// firstPartition keeps the order across slots, hashing the slot keys would
+// only keep it within a slot.
+var firstPartition = kafka.BalancerFunc(func(msg kafka.Message, partitions ...int) int {
+	return partitions[0]
+})
+
+// Publish retries the transient errors until the broker acknowledges msgs or
+// Close is called, the other errors are returned.
+func (k *Kafka) Publish(msgs []Message) error {
+	kmsgs := make([]kafka.Message, len(msgs))
+	for i, m := range msgs {
+		kmsgs[i] = kafka.Message{Key: m.Key, Value: m.Value}
+	}
+
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		err := k.w.WriteMessages(k.ctx, kmsgs...)
+		if err == nil || !transient(err) || k.ctx.Err() != nil {
+			return err
+		}
+
+		log.Logger.Warn("kafka publish failed, retry", zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+		select {
+		case <-time.After(backoff):
+		case <-k.ctx.Done():
+			return err
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// transient are the errors the broker recovers from: the kafka ones flagged
+// temporary and the network ones.
+func transient(err error) bool {
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) {
+		for _, e := range writeErrs {
+			if e != nil && !transient(e) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) {
+		return kafkaErr.Temporary()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func (k *Kafka) Close() error {
+	k.cancel()
+	return k.w.Close()
+}
@@ -0,0 +1,126 @@
+package stream
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"sol_block_extractord/sink"
+	"sol_block_extractord/types"
+)
+
+const (
+	EventOperation = "operation"
+	EventCommit    = "commit"
+	EventRollback  = "rollback"
+	EventFinalized = "finalized"
+	EventReplace   = "replace"
+)
+
+// Message is published with Key as the ordering key.
+type Message struct {
+	Key   []byte
+	Value []byte
+}
+
+// Publisher delivers messages to a broker, it returns once the broker has
+// acknowledged all of them.
+type Publisher interface {
+	Publish(msgs []Message) error
+	Close() error
+}
+
+// Event is the JSON value of a message, keyed by the slot. A commit follows
+// the operations of its slot, it's published for the slots without
+// operations too. With commitment confirmed the operations are provisional,
+// a rollback takes back the ones from its slot on, which are published again
+// if still valid, and a finalized makes the ones up to its slot final. A
+// replace takes back every final operation, a merge publishes the whole
+// ledger checked again after it, without commits.
+type Event struct {
+	Type       string           `json:"type"`
+	Slot       uint64           `json:"slot"`
+	Operation  *types.Operation `json:"operation,omitempty"`
+	Operations int              `json:"operations,omitempty"` // the number of operations of the slot, in a commit
+}
+
+// Sink publishes the accepted operations and the block commits. The events of
+// a batch are published before the checkpoint moves past it, they are
+// delivered at least once.
+type Sink struct {
+	pub Publisher
+}
+
+var _ sink.Sink = (*Sink)(nil)
+
+func New(pub Publisher) *Sink {
+	return &Sink{pub: pub}
+}
+
+// LoadOperations loads nothing, a stream can't rebuild the ledger.
+func (s *Sink) LoadOperations(fn func(op types.Operation)) error {
+	return nil
+}
+
+// LoadRejections loads nothing either.
+func (s *Sink) LoadRejections(fn func(r sink.Rejection)) error {
+	return nil
+}
+
+func (s *Sink) Write(b sink.Batch) error {
+	msgs, err := messages(b)
+	if err != nil || len(msgs) == 0 {
+		return err
+	}
+	return s.pub.Publish(msgs)
+}
+
+func messages(b sink.Batch) (msgs []Message, err error) {
+	if b.Replace {
+		msgs, err = appendEvent(msgs, Event{Type: EventReplace})
+		for i := 0; i < len(b.Ops) && err == nil; i++ {
+			msgs, err = appendEvent(msgs, Event{Type: EventOperation, Slot: b.Ops[i].Slot, Operation: &b.Ops[i]})
+		}
+		return
+	}
+
+	if b.Rollback {
+		msgs, err = appendEvent(msgs, Event{Type: EventRollback, Slot: b.RollbackFrom})
+		if err != nil {
+			return
+		}
+	}
+
+	i := 0
+	for _, slot := range b.Slots {
+		n := 0
+		for ; i < len(b.Ops) && b.Ops[i].Slot <= slot; i++ {
+			msgs, err = appendEvent(msgs, Event{Type: EventOperation, Slot: slot, Operation: &b.Ops[i]})
+			if err != nil {
+				return
+			}
+			n++
+		}
+
+		msgs, err = appendEvent(msgs, Event{Type: EventCommit, Slot: slot, Operations: n})
+		if err != nil {
+			return
+		}
+	}
+
+	if b.Finalized != 0 {
+		msgs, err = appendEvent(msgs, Event{Type: EventFinalized, Slot: b.Finalized})
+	}
+	return
+}
+
+func appendEvent(msgs []Message, e Event) ([]Message, error) {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return append(msgs, Message{Key: []byte(strconv.FormatUint(e.Slot, 10)), Value: value}), nil
+}
+
+func (s *Sink) Close() error {
+	return s.pub.Close()
+}
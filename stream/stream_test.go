@@ -0,0 +1,184 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+
+	"sol_block_extractord/config"
+	"sol_block_extractord/sink"
+	"sol_block_extractord/types"
+)
+
+// broker stands in for kafka, it refuses the first fail publishes.
+type broker struct {
+	mu   sync.Mutex
+	msgs []Message
+	fail int
+}
+
+func (b *broker) Publish(msgs []Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.fail > 0 {
+		b.fail--
+		return errors.New("broker unavailable")
+	}
+	b.msgs = append(b.msgs, msgs...)
+	return nil
+}
+
+func (b *broker) Close() error {
+	return nil
+}
+
+func (b *broker) events(t *testing.T) (events []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, m := range b.msgs {
+		var e Event
+		require.NoError(t, json.Unmarshal(m.Value, &e))
+		require.Equal(t, strconv.FormatUint(e.Slot, 10), string(m.Key))
+		events = append(events, e)
+	}
+	return
+}
+
+// store is the primary sink the ledger is rebuilt from.
+type store struct {
+	ops []types.Operation
+}
+
+func (s *store) LoadOperations(fn func(op types.Operation)) error {
+	for _, op := range s.ops {
+		fn(op)
+	}
+	return nil
+}
+
+func (s *store) LoadRejections(fn func(r sink.Rejection)) error {
+	return nil
+}
+
+func (s *store) Write(b sink.Batch) error {
+	s.ops = append(s.ops, b.Ops...)
+	return nil
+}
+
+func (s *store) Close() error {
+	return nil
+}
+
+func mint(slot uint64, txIdx int, from string) types.Operation {
+	op := types.Operation{Slot: slot, TxHash: from, From: from, Value: uint256.NewInt(0),
+		M: types.Memo{P: "test-20", Tick: "TEST", Op: types.OpMint, Amt: "10", AmtN: 10}}
+	op.SetupBlockInfo(slot, 1700000000, txIdx)
+	return op
+}
+
+func TestMessages(t *testing.T) {
+	b := &broker{}
+	s := New(b)
+
+	ops := []types.Operation{mint(10, 0, "a"), mint(10, 1, "b"), mint(12, 0, "c")}
+	require.NoError(t, s.Write(sink.Batch{Slots: []uint64{10, 11, 12}, Ops: ops}))
+
+	events := b.events(t)
+	require.Len(t, events, 6)
+	require.Equal(t, []string{EventOperation, EventOperation, EventCommit, EventCommit, EventOperation, EventCommit},
+		[]string{events[0].Type, events[1].Type, events[2].Type, events[3].Type, events[4].Type, events[5].Type})
+	require.Equal(t, "b", events[1].Operation.TxHash)
+	require.Equal(t, Event{Type: EventCommit, Slot: 10, Operations: 2}, events[2])
+	require.Equal(t, Event{Type: EventCommit, Slot: 11}, events[3])
+
+	require.NoError(t, s.Write(sink.Batch{AllBalances: true}))
+	require.Len(t, b.msgs, 6)
+}
+
+func TestRollbackMessages(t *testing.T) {
+	b := &broker{}
+	s := New(b)
+
+	op := mint(12, 0, "c")
+	op.Provisional = true
+	require.NoError(t, s.Write(sink.Batch{Rollback: true, RollbackFrom: 11, Slots: []uint64{12}, Ops: []types.Operation{op}, AllBalances: true}))
+	require.NoError(t, s.Write(sink.Batch{Finalized: 12}))
+
+	events := b.events(t)
+	require.Len(t, events, 4)
+	require.Equal(t, Event{Type: EventRollback, Slot: 11}, events[0])
+	require.True(t, events[1].Operation.Provisional)
+	require.Equal(t, Event{Type: EventCommit, Slot: 12, Operations: 1}, events[2])
+	require.Equal(t, Event{Type: EventFinalized, Slot: 12}, events[3])
+}
+
+func TestReplaceMessages(t *testing.T) {
+	b := &broker{}
+	s := New(b)
+
+	ops := []types.Operation{mint(10, 0, "a"), mint(12, 0, "c")}
+	require.NoError(t, s.Write(sink.Batch{Replace: true, Ops: ops, AllBalances: true}))
+
+	events := b.events(t)
+	require.Len(t, events, 3)
+	require.Equal(t, Event{Type: EventReplace}, events[0])
+	require.Equal(t, uint64(10), events[1].Slot)
+	require.Equal(t, "c", events[2].Operation.TxHash)
+}
+
+// TestAtLeastOnce checks a batch the broker refused is neither checkpointed
+// nor stored, so it's published again after a restart.
+func TestAtLeastOnce(t *testing.T) {
+	config.Cfg.Pg.BatchSize = 100
+	config.Cfg.Pg.BatchInterval = time.Hour
+	config.Cfg.Biz = config.Business{DeployHeight: 1, Ins: config.Inscription{P: "test-20", Tick: "TEST"}}
+
+	primary := &store{}
+	b := &broker{fail: 1}
+	blocks := func() chan sink.Block {
+		ch := make(chan sink.Block, 2)
+		ch <- sink.Block{Slot: 10, Ops: []types.Operation{mint(10, 0, "a")}}
+		ch <- sink.Block{Slot: 11}
+		close(ch)
+		return ch
+	}
+
+	var checkpoints []uint64
+	checkpoint := func(slot uint64) { checkpoints = append(checkpoints, slot) }
+
+	err := sink.PostOperations(sink.FanOut{primary, New(b)}, blocks(), checkpoint, nil)
+	require.ErrorContains(t, err, "broker unavailable")
+	require.Empty(t, checkpoints)
+	require.Empty(t, primary.ops)
+
+	require.NoError(t, sink.PostOperations(sink.FanOut{primary, New(b)}, blocks(), checkpoint, nil))
+	require.Equal(t, []uint64{11}, checkpoints)
+	require.Len(t, primary.ops, 1)
+	events := b.events(t)
+	require.Len(t, events, 3)
+	require.Equal(t, "a", events[0].Operation.From)
+}
+
+func TestTransient(t *testing.T) {
+	require.True(t, transient(kafka.LeaderNotAvailable))
+	require.True(t, transient(fmt.Errorf("write: %w", io.ErrUnexpectedEOF)))
+	require.True(t, transient(kafka.WriteErrors{nil, kafka.NotLeaderForPartition}))
+	require.False(t, transient(kafka.WriteErrors{kafka.NotLeaderForPartition, kafka.MessageSizeTooLarge}))
+	require.False(t, transient(kafka.TopicAuthorizationFailed))
+	require.False(t, transient(errors.New("broker unavailable")))
+}
+
+func TestFirstPartition(t *testing.T) {
+	for _, slot := range []string{"10", "11", "12"} {
+		require.Equal(t, 3, firstPartition.Balance(kafka.Message{Key: []byte(slot)}, 3, 4, 5))
+	}
+}
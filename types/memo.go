@@ -21,17 +21,59 @@ const (
 	ColumnNameAmt  = "amt"
 	ColumnNameLim  = "lim"
 	ColumnNameMax  = "max"
+	ColumnNameTo   = "to"
+
+	ColumnNamePrice   = "price"
+	ColumnNameListing = "listing"
 )
 
 const (
 	OpDeploy   = "deploy"
 	OpMint     = "mint"
 	OpTransfer = "transfer"
+	OpBurn     = "burn"
+	OpList     = "list"
+	OpBuy      = "buy"
+	OpCancel   = "cancel"
 )
 
 const ReasonWrongTick = "wrong tick"
 
-var validOps = []string{OpDeploy, OpMint, OpTransfer} // todo as parameters
+// DefaultOps is the op set used when the protocol doesn't configure one.
+func DefaultOps(freeMint bool) []config.Op {
+	return []config.Op{
+		{Name: OpDeploy, Fields: []string{ColumnNameMax, ColumnNameLim}},
+		{Name: OpMint, Fields: []string{ColumnNameAmt}, Transfer: !freeMint},
+		{Name: OpTransfer, Fields: []string{ColumnNameAmt, ColumnNameTo}},
+		{Name: OpBurn, Fields: []string{ColumnNameAmt}},
+		{Name: OpList, Fields: []string{ColumnNameAmt, ColumnNamePrice}},
+		{Name: OpBuy, Fields: []string{ColumnNameListing}, Transfer: true},
+		{Name: OpCancel, Fields: []string{ColumnNameListing}},
+	}
+}
+
+func Ops() []config.Op {
+	if len(config.Cfg.Biz.Ins.Ops) != 0 {
+		return config.Cfg.Biz.Ins.Ops
+	}
+	return DefaultOps(config.Cfg.Biz.FreeMint)
+}
+
+func OpNames() (names []string) {
+	for _, op := range Ops() {
+		names = append(names, op.Name)
+	}
+	return
+}
+
+func FindOp(name string) (config.Op, bool) {
+	for _, op := range Ops() {
+		if op.Name == name {
+			return op, true
+		}
+	}
+	return config.Op{}, false
+}
 
 const MemoPrefix = "data:,"
 
@@ -52,6 +94,11 @@ type Memo struct {
 	AmtN int64
 	LimN int64
 	MaxN int64
+
+	Price   string
+	PriceN  int64
+	Listing string // tx hash of the list op a buy or cancel refers to
+	To      string // recipient of a transfer
 }
 
 func (m *Memo) IsMintOp() bool {
@@ -59,33 +106,79 @@ func (m *Memo) IsMintOp() bool {
 }
 
 func (m *Memo) ShouldParseTxTransferValue() bool {
-	return m.IsMintOp() && !config.Cfg.Biz.FreeMint // || m.IsBuyOp()
+	op, ok := FindOp(m.Op)
+	return ok && op.Transfer
 }
 
-func (m *Memo) IsValidOp() (bool, string) {
-	switch m.Op {
-	case OpDeploy:
-		return m.MaxN > 0 && m.LimN > 0 && m.MaxN >= m.LimN, "wrong max or lim in deploy op"
-	case OpMint:
-		return m.AmtN > 0, "wrong amt in mint"
-	case OpTransfer:
-		return m.AmtN > 0, "wrong amt in transfer"
+func (m *Memo) fieldN(field string) int64 {
+	switch field {
+	case ColumnNameAmt:
+		return m.AmtN
+	case ColumnNameLim:
+		return m.LimN
+	case ColumnNameMax:
+		return m.MaxN
+	case ColumnNamePrice:
+		return m.PriceN
 	default:
-		return false, "pass"
+		return 0
+	}
+}
+
+func (m *Memo) IsValidOp() (bool, string) {
+	op, ok := FindOp(m.Op)
+	if !ok {
+		return false, fmt.Sprintf("op %s not supported", m.Op)
+	}
+
+	for _, field := range op.Fields {
+		if field == ColumnNameTo {
+			continue // the recipient is checked by the transfer rule
+		}
+		if field == ColumnNameListing {
+			if m.Listing == "" {
+				return false, fmt.Sprintf("no %s in %s op", field, m.Op)
+			}
+		} else if m.fieldN(field) <= 0 {
+			return false, fmt.Sprintf("wrong %s in %s op", field, m.Op)
+		}
 	}
+
+	if m.Op == OpDeploy && m.MaxN < m.LimN {
+		return false, "wrong max or lim in deploy op"
+	}
+
+	return true, ""
 }
 
+// AdjustOp clears the fields the op doesn't use.
 func (m *Memo) AdjustOp() {
-	switch m.Op {
-	case OpDeploy:
+	op, ok := FindOp(m.Op)
+	if !ok {
+		return
+	}
+
+	if !op.HasField(ColumnNameAmt) {
 		m.Amt = ""
 		m.AmtN = 0
-	case OpMint, OpTransfer:
-		m.Max = ""
-		m.MaxN = 0
+	}
+	if !op.HasField(ColumnNameLim) {
 		m.Lim = ""
 		m.LimN = 0
-	default:
+	}
+	if !op.HasField(ColumnNameMax) {
+		m.Max = ""
+		m.MaxN = 0
+	}
+	if !op.HasField(ColumnNamePrice) {
+		m.Price = ""
+		m.PriceN = 0
+	}
+	if !op.HasField(ColumnNameListing) {
+		m.Listing = ""
+	}
+	if !op.HasField(ColumnNameTo) {
+		m.To = ""
 	}
 }
 
@@ -97,9 +190,30 @@ func (m *Memo) IsValidTick() (pass bool, reason string) {
 	return
 }
 
-func ParseMemo(base58Memo string) (memo Memo, err error) {
-	memoBase58Decoded := string(base58.Decode(base58Memo))
-	memoBase64Decoded, err := base64.StdEncoding.DecodeString(memoBase58Decoded)
+// decodeMemo base64-decodes the memo, base58-encoded as the memo
+// instructions carry it or as is. A memo may be valid in both, the decoding
+// starting with the prefix wins.
+func decodeMemo(rawMemo string) (decoded []byte, err error) {
+	for _, encoded := range []string{string(base58.Decode(rawMemo)), rawMemo} {
+		d, decodeErr := base64.StdEncoding.DecodeString(encoded)
+		if decodeErr != nil {
+			if decoded == nil {
+				err = decodeErr
+			}
+			continue
+		}
+		if strings.HasPrefix(string(d), MemoPrefix) {
+			return d, nil
+		}
+		if decoded == nil {
+			decoded, err = d, nil
+		}
+	}
+	return
+}
+
+func ParseMemo(rawMemo string) (memo Memo, err error) {
+	memoBase64Decoded, err := decodeMemo(rawMemo)
 	if err != nil {
 		err = errors.New(fmt.Sprintf("decode memo in base64 err: %v", err))
 		return
@@ -172,6 +286,26 @@ func ParseMemo(base58Memo string) (memo Memo, err error) {
 		}
 	}
 
+	price, priceE := jsonparser.GetString(memoJson, ColumnNamePrice)
+	if priceE == nil {
+		memo.Price = price
+
+		priceN, s2iE := strconv.ParseInt(price, 10, 64)
+		if s2iE == nil {
+			memo.PriceN = priceN
+		}
+	}
+
+	listing, listingE := jsonparser.GetString(memoJson, ColumnNameListing)
+	if listingE == nil {
+		memo.Listing = listing
+	}
+
+	to, toE := jsonparser.GetString(memoJson, ColumnNameTo)
+	if toE == nil {
+		memo.To = to
+	}
+
 	memo.AdjustOp()
 
 	return
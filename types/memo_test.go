@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcutil/base58"
 	"github.com/stretchr/testify/require"
 
 	"sol_block_extractord/config"
@@ -38,3 +39,77 @@ func TestParseMemo(t *testing.T) {
 		require.Equal(t, tc.pass, err == nil, fmt.Sprintf("case%d failed, err:%v", i, err))
 	}
 }
+
+func TestParseMemoBase58(t *testing.T) {
+	config.Cfg.Biz.Ins.P = "test-20"
+
+	for i, tc := range parseMemoCases {
+		_, err := ParseMemo(base58.Encode([]byte(base64.StdEncoding.EncodeToString([]byte(tc.input)))))
+		require.Equal(t, tc.pass, err == nil, fmt.Sprintf("case%d failed, err:%v", i, err))
+	}
+
+	_, err := ParseMemo(base58.Encode([]byte(`data:,{"p":"test-20","op":"mint","tick":"ttta","amt":"1"}`)))
+	require.Error(t, err)
+}
+
+func TestConfiguredOps(t *testing.T) {
+	config.Cfg.Biz.FreeMint = false
+	config.Cfg.Biz.Ins.Ops = nil
+
+	mint := Memo{Op: OpMint, Amt: "100", AmtN: 100}
+	require.True(t, mint.ShouldParseTxTransferValue())
+	config.Cfg.Biz.FreeMint = true
+	require.False(t, mint.ShouldParseTxTransferValue())
+
+	config.Cfg.Biz.Ins.Ops = []config.Op{
+		{Name: OpMint, Fields: []string{ColumnNameAmt}},
+		{Name: "burn", Fields: []string{ColumnNameAmt}},
+		{Name: "buy", Fields: []string{ColumnNameAmt}, Transfer: true},
+	}
+	defer func() { config.Cfg.Biz.Ins.Ops = nil }()
+
+	require.Equal(t, []string{OpMint, "burn", "buy"}, OpNames())
+
+	pass, _ := mint.IsValidOp()
+	require.True(t, pass)
+	require.False(t, mint.ShouldParseTxTransferValue())
+
+	deploy := Memo{Op: OpDeploy, Max: "100", MaxN: 100, Lim: "10", LimN: 10}
+	pass, _ = deploy.IsValidOp()
+	require.False(t, pass)
+
+	burn := Memo{Op: "burn", Amt: "abc", Lim: "10", LimN: 10}
+	pass, _ = burn.IsValidOp()
+	require.False(t, pass)
+	burn.AdjustOp()
+	require.Equal(t, "", burn.Lim)
+	require.Equal(t, int64(0), burn.LimN)
+	require.Equal(t, "abc", burn.Amt)
+
+	buy := Memo{Op: "buy", Amt: "5", AmtN: 5}
+	pass, _ = buy.IsValidOp()
+	require.True(t, pass)
+	require.True(t, buy.ShouldParseTxTransferValue())
+}
+
+func TestMarketOps(t *testing.T) {
+	config.Cfg.Biz.Ins.Ops = nil
+
+	list := Memo{Op: OpList, Amt: "10", AmtN: 10}
+	pass, _ := list.IsValidOp()
+	require.False(t, pass)
+	list.Price, list.PriceN = "1000", 1000
+	pass, _ = list.IsValidOp()
+	require.True(t, pass)
+	require.False(t, list.ShouldParseTxTransferValue())
+
+	buy := Memo{Op: OpBuy, Amt: "10", AmtN: 10}
+	pass, _ = buy.IsValidOp()
+	require.False(t, pass)
+	buy.Listing = "5VERv8NMvzbJMEkV8xnrLkEaWRtSz9CosKDYjCJjBRnbJLgp8uirBgmQpjKhoR4tjF3ZpRzrFmBV6UjKdiSZkQUW"
+	buy.AdjustOp()
+	require.Equal(t, int64(0), buy.AmtN)
+	pass, _ = buy.IsValidOp()
+	require.True(t, pass)
+	require.True(t, buy.ShouldParseTxTransferValue())
+}
@@ -7,9 +7,11 @@ import (
 )
 
 type Operation struct { // TODO rename to Transaction
+	Slot         uint64 // of the block, the business rules versions are keyed by it
 	BlockHeight  uint64
 	BlockTimeSec int64
 	TxIdx        int
+	InstIdx      int // of the memo instruction
 	TxHash       string
 	From         string
 	To           string
@@ -17,6 +19,7 @@ type Operation struct { // TODO rename to Transaction
 	Value        *uint256.Int
 	MemoRaw      string
 	M            Memo
+	Provisional  bool // of a block not finalized yet, rolled back if its slot is dropped
 
 	BlockHeightStr  string
 	BlockTimeSecStr string
@@ -34,3 +37,28 @@ func (op *Operation) SetupBlockInfo(blockHeight uint64, blockTimeSec int64, txId
 	op.BlockHeightStr = strconv.FormatUint(op.BlockHeight, 10)
 	op.BlockTimeSecStr = strconv.FormatInt(op.BlockTimeSec, 10)
 }
+
+// Restore rebuilds the fields of an op read back from storage, value being
+// written by uint256.Int.String().
+func (op *Operation) Restore(blockHeight uint64, blockTimeSec int64, value string) {
+	op.SetupBlockInfo(blockHeight, blockTimeSec, op.TxIdx)
+	op.Value, _ = uint256.FromHex(value)
+	op.M.AmtN, _ = strconv.ParseInt(op.M.Amt, 10, 64)
+	op.M.LimN, _ = strconv.ParseInt(op.M.Lim, 10, 64)
+	op.M.MaxN, _ = strconv.ParseInt(op.M.Max, 10, 64)
+	if m, err := ParseMemo(op.MemoRaw); err == nil { // price, listing and the recipient are only kept in the raw memo
+		op.M.Price, op.M.PriceN, op.M.Listing, op.M.To = m.Price, m.PriceN, m.Listing, m.To
+	}
+}
+
+// Before tells whether op comes before other on chain, by (height, txIdx,
+// instIdx): the block height grows with the slot and every sink keeps it.
+func (op *Operation) Before(other *Operation) bool {
+	if op.BlockHeight != other.BlockHeight {
+		return op.BlockHeight < other.BlockHeight
+	}
+	if op.TxIdx != other.TxIdx {
+		return op.TxIdx < other.TxIdx
+	}
+	return op.InstIdx < other.InstIdx
+}
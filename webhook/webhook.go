@@ -0,0 +1,332 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"sol_block_extractord/config"
+	"sol_block_extractord/log"
+	"sol_block_extractord/sink"
+	"sol_block_extractord/types"
+)
+
+const (
+	HeaderSignature = "X-Extractord-Signature" // sha256=hex(HMAC-SHA256(secret, body))
+	HeaderDelivery  = "X-Extractord-Delivery"  // txHash:instIndex, the same on every retry
+
+	defaultMaxAttempts = 5
+	defaultBackoff     = time.Second
+	maxBackoff         = time.Minute
+	queueSize          = 1000
+	closeTimeout       = 10 * time.Second
+)
+
+var (
+	errQueueFull = errors.New("webhook queue full")
+	errClosed    = errors.New("webhook notifier closed")
+)
+
+// Payload is the JSON body posted for an operation.
+type Payload struct {
+	Subscription string `json:"subscription"`
+	Slot         uint64 `json:"slot"`
+	BlockHeight  uint64 `json:"blockHeight"`
+	BlockTime    int64  `json:"blockTime"`
+	TxIndex      int    `json:"txIndex"`
+	TxHash       string `json:"txHash"`
+	InstIndex    int    `json:"instIndex"`
+	Op           string `json:"op"`
+	Tick         string `json:"tick"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	Amt          int64  `json:"amt,omitempty"`
+	Memo         string `json:"memo"`
+}
+
+// DeadLetter is a payload that couldn't be delivered.
+type DeadLetter struct {
+	Subscription string
+	URL          string
+	Delivery     string
+	Payload      []byte
+	Attempts     int
+	Err          string
+}
+
+type DeadLetters interface {
+	Add(d DeadLetter) error
+}
+
+// receiver is the address credited by op: the memo's recipient for a
+// transfer, else the minter, buyer or seller.
+func receiver(op types.Operation) string {
+	if op.M.Op == types.OpTransfer {
+		return op.To
+	}
+	return op.From
+}
+
+func contains(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func Match(w config.Webhook, op types.Operation) bool {
+	return contains(w.Ticks, op.M.Tick) && contains(w.Ops, op.M.Op) && contains(w.From, op.From) && contains(w.To, receiver(op))
+}
+
+func Sign(secret config.Secret, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret.Reveal()))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type delivery struct {
+	id   string
+	body []byte
+}
+
+type subscription struct {
+	config.Webhook
+	queue chan delivery
+}
+
+// Notifier posts the final operations to the matching webhooks, in order per
+// webhook. The provisional ones are held until finalized and dropped when
+// rolled back, a webhook never sees an operation taken back. The payloads not
+// delivered after MaxAttempts, or not queued because the webhook is too far
+// behind, go to the dead letters.
+type Notifier struct {
+	subs        []*subscription
+	client      *http.Client
+	deadLetters DeadLetters
+	wg          sync.WaitGroup
+
+	// ctx is cancelled once the Close deadline is past, the deliveries in
+	// progress are given up and the queued ones go to the dead letters
+	ctx          context.Context
+	cancel       context.CancelFunc
+	closeTimeout time.Duration
+
+	held []types.Operation // provisional, in slot order
+}
+
+var _ sink.Sink = (*Notifier)(nil)
+
+func New(webhooks []config.Webhook, deadLetters DeadLetters) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifier{client: &http.Client{Timeout: 10 * time.Second}, deadLetters: deadLetters, ctx: ctx, cancel: cancel, closeTimeout: closeTimeout}
+	for _, w := range webhooks {
+		if w.MaxAttempts == 0 {
+			w.MaxAttempts = defaultMaxAttempts
+		}
+		if w.Backoff == 0 {
+			w.Backoff = defaultBackoff
+		}
+
+		sub := &subscription{Webhook: w, queue: make(chan delivery, queueSize)}
+		n.subs = append(n.subs, sub)
+		n.wg.Add(1)
+		go n.deliver(sub)
+	}
+	return n
+}
+
+// LoadOperations loads nothing, the webhooks can't rebuild the ledger.
+func (n *Notifier) LoadOperations(fn func(op types.Operation)) error {
+	return nil
+}
+
+// LoadRejections loads nothing either.
+func (n *Notifier) LoadRejections(fn func(r sink.Rejection)) error {
+	return nil
+}
+
+// Write queues the payloads of the final operations, it never blocks: a
+// payload a webhook queue has no room for goes to the dead letters. The
+// ledger a merge replaces isn't notified again.
+func (n *Notifier) Write(b sink.Batch) error {
+	if b.Replace {
+		return nil
+	}
+
+	if b.Rollback {
+		held := n.held[:0]
+		for _, op := range n.held {
+			if op.Slot < b.RollbackFrom {
+				held = append(held, op)
+			}
+		}
+		n.held = held
+	}
+
+	for _, op := range b.Ops {
+		if op.Provisional {
+			n.held = append(n.held, op)
+			continue
+		}
+		if err := n.queue(op); err != nil {
+			return err
+		}
+	}
+
+	if b.Finalized != 0 {
+		i := 0
+		for ; i < len(n.held) && n.held[i].Slot <= b.Finalized; i++ {
+			if err := n.queue(n.held[i]); err != nil {
+				return err
+			}
+		}
+		n.held = append(n.held[:0], n.held[i:]...)
+	}
+	return nil
+}
+
+func (n *Notifier) queue(op types.Operation) error {
+	for _, sub := range n.subs {
+		if !Match(sub.Webhook, op) {
+			continue
+		}
+
+		body, err := json.Marshal(Payload{
+			Subscription: sub.Name,
+			Slot:         op.Slot,
+			BlockHeight:  op.BlockHeight,
+			BlockTime:    op.BlockTimeSec,
+			TxIndex:      op.TxIdx,
+			TxHash:       op.TxHash,
+			InstIndex:    op.InstIdx,
+			Op:           op.M.Op,
+			Tick:         op.M.Tick,
+			From:         op.From,
+			To:           receiver(op),
+			Amt:          op.M.AmtN,
+			Memo:         op.MemoRaw,
+		})
+		if err != nil {
+			return err
+		}
+
+		d := delivery{id: fmt.Sprintf("%s:%d", op.TxHash, op.InstIdx), body: body}
+		select {
+		case sub.queue <- d:
+		default:
+			n.deadLetter(sub, d, 0, errQueueFull)
+		}
+	}
+	return nil
+}
+
+func (n *Notifier) deliver(sub *subscription) {
+	defer n.wg.Done()
+	for d := range sub.queue {
+		if n.ctx.Err() != nil {
+			n.deadLetter(sub, d, 0, errClosed)
+			continue
+		}
+
+		attempts, err := n.post(sub, d)
+		if err == nil {
+			continue
+		}
+
+		log.Logger.Error("webhook delivery failed", zap.String("webhook", sub.Name), zap.String("delivery", d.id), zap.Int("attempts", attempts), zap.Error(err))
+		n.deadLetter(sub, d, attempts, err)
+	}
+}
+
+func (n *Notifier) deadLetter(sub *subscription, d delivery, attempts int, cause error) {
+	if n.deadLetters == nil {
+		log.Logger.Error("webhook payload dropped", zap.String("webhook", sub.Name), zap.String("delivery", d.id), zap.ByteString("payload", d.body), zap.Error(cause))
+		return
+	}
+	err := n.deadLetters.Add(DeadLetter{Subscription: sub.Name, URL: sub.URL, Delivery: d.id, Payload: d.body, Attempts: attempts, Err: cause.Error()})
+	if err != nil {
+		log.Logger.Error("webhook dead letter failed", zap.String("webhook", sub.Name), zap.String("delivery", d.id), zap.ByteString("payload", d.body), zap.Error(err))
+	}
+}
+
+// post retries with an exponential backoff on network errors, 429 and 5xx.
+func (n *Notifier) post(sub *subscription, d delivery) (attempts int, err error) {
+	backoff := sub.Backoff
+	for attempts = 1; ; attempts++ {
+		var retry bool
+		retry, err = n.postOnce(sub, d)
+		if err == nil || !retry || attempts >= sub.MaxAttempts {
+			return
+		}
+
+		log.Logger.Warn("webhook delivery attempt failed", zap.String("webhook", sub.Name), zap.String("delivery", d.id), zap.Int("attempt", attempts), zap.Duration("retryIn", backoff), zap.Error(err))
+		select {
+		case <-time.After(backoff):
+		case <-n.ctx.Done():
+			return attempts, errClosed
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (n *Notifier) postOnce(sub *subscription, d delivery) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, sub.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, d.body))
+	req.Header.Set(HeaderDelivery, d.id)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("status %s", resp.Status)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// Close delivers the queued payloads before returning, the ones not delivered
+// within closeTimeout go to the dead letters.
+func (n *Notifier) Close() error {
+	for _, sub := range n.subs {
+		close(sub.queue)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(n.closeTimeout):
+		log.Logger.Warn("webhook deliveries not done in time, dead letter the rest", zap.Duration("timeout", n.closeTimeout))
+		n.cancel()
+		<-done
+	}
+	n.cancel()
+	return nil
+}
@@ -0,0 +1,195 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	"sol_block_extractord/config"
+	"sol_block_extractord/sink"
+	"sol_block_extractord/types"
+)
+
+type deadLetters struct {
+	mu      sync.Mutex
+	letters []DeadLetter
+}
+
+func (d *deadLetters) Add(dl DeadLetter) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.letters = append(d.letters, dl)
+	return nil
+}
+
+func newOp(op, from, to string) types.Operation {
+	o := types.Operation{Slot: 10, TxHash: op + from, From: from, To: to, Value: uint256.NewInt(0),
+		M: types.Memo{P: "test-20", Tick: "TEST", Op: op, Amt: "5", AmtN: 5}}
+	o.SetupBlockInfo(9, 1700000000, 0)
+	return o
+}
+
+func TestMatch(t *testing.T) {
+	w := config.Webhook{Ticks: []string{"TEST"}, To: []string{"wallet"}}
+	require.True(t, Match(w, newOp(types.OpTransfer, "a", "wallet")))
+	require.True(t, Match(w, newOp(types.OpMint, "wallet", "memo")))
+	require.False(t, Match(w, newOp(types.OpTransfer, "wallet", "b")))
+
+	w = config.Webhook{Ops: []string{types.OpDeploy}}
+	require.True(t, Match(w, newOp(types.OpDeploy, "a", "memo")))
+	require.False(t, Match(w, newOp(types.OpMint, "a", "memo")))
+}
+
+func TestDeliver(t *testing.T) {
+	var mu sync.Mutex
+	var payloads []Payload
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		require.Equal(t, Sign("s3cret", body), r.Header.Get(HeaderSignature))
+		require.Equal(t, "transfera:0", r.Header.Get(HeaderDelivery))
+
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var p Payload
+		require.NoError(t, json.Unmarshal(body, &p))
+		payloads = append(payloads, p)
+	}))
+	defer server.Close()
+
+	dl := &deadLetters{}
+	n := New([]config.Webhook{{Name: "wallet", URL: server.URL, Secret: "s3cret", To: []string{"wallet"}, Backoff: time.Millisecond}}, dl)
+	require.NoError(t, n.Write(sink.Batch{Ops: []types.Operation{newOp(types.OpTransfer, "a", "wallet"), newOp(types.OpTransfer, "a", "b")}}))
+	require.NoError(t, n.Close())
+
+	require.Equal(t, 2, calls)
+	require.Equal(t, []Payload{{Subscription: "wallet", Slot: 10, BlockHeight: 9, BlockTime: 1700000000, TxHash: "transfera", Op: types.OpTransfer, Tick: "TEST", From: "a", To: "wallet", Amt: 5}}, payloads)
+	require.Empty(t, dl.letters)
+}
+
+func TestDeadLetter(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[r.URL.Path]++
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	dl := &deadLetters{}
+	n := New([]config.Webhook{
+		{Name: "down", URL: server.URL + "/down", Secret: "s", MaxAttempts: 3, Backoff: time.Millisecond},
+		{Name: "gone", URL: server.URL + "/gone", Secret: "s", Backoff: time.Millisecond},
+	}, dl)
+	require.NoError(t, n.Write(sink.Batch{Ops: []types.Operation{newOp(types.OpDeploy, "a", "memo")}}))
+	require.NoError(t, n.Close())
+
+	require.Equal(t, map[string]int{"/down": 3, "/gone": 1}, calls)
+	require.Len(t, dl.letters, 2)
+	for _, l := range dl.letters {
+		require.Equal(t, "deploya:0", l.Delivery)
+		require.Equal(t, calls["/"+l.Subscription], l.Attempts)
+		require.Contains(t, string(l.Payload), `"op":"deploy"`)
+	}
+}
+
+// TestProvisional checks the provisional operations are delivered once
+// finalized, the rolled back ones never.
+func TestProvisional(t *testing.T) {
+	var mu sync.Mutex
+	var delivered []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		delivered = append(delivered, r.Header.Get(HeaderDelivery))
+	}))
+	defer server.Close()
+
+	provisional := func(slot uint64, from string) types.Operation {
+		op := newOp(types.OpMint, from, "")
+		op.Slot, op.Provisional = slot, true
+		return op
+	}
+
+	n := New([]config.Webhook{{Name: "all", URL: server.URL, Secret: "s"}}, nil)
+	require.NoError(t, n.Write(sink.Batch{Slots: []uint64{10, 11, 12}, Ops: []types.Operation{provisional(10, "a"), provisional(11, "b"), provisional(12, "c")}}))
+	require.NoError(t, n.Write(sink.Batch{Finalized: 10}))
+	require.NoError(t, n.Write(sink.Batch{Rollback: true, RollbackFrom: 11, Slots: []uint64{11, 12}, Ops: []types.Operation{newOp(types.OpMint, "d", ""), provisional(12, "c")}}))
+	require.NoError(t, n.Write(sink.Batch{Finalized: 12}))
+	require.NoError(t, n.Close())
+
+	require.Equal(t, []string{"minta:0", "mintd:0", "mintc:0"}, delivered)
+}
+
+// TestQueueFull checks a webhook too far behind doesn't block the writes, the
+// payloads it has no room for go to the dead letters.
+func TestQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	dl := &deadLetters{}
+	n := New([]config.Webhook{{Name: "slow", URL: server.URL, Secret: "s"}}, dl)
+	ops := make([]types.Operation, queueSize+2)
+	for i := range ops {
+		ops[i] = newOp(types.OpMint, strconv.Itoa(i), "")
+	}
+	require.NoError(t, n.Write(sink.Batch{Ops: ops}))
+
+	dl.mu.Lock()
+	require.NotEmpty(t, dl.letters)
+	for _, l := range dl.letters {
+		require.Equal(t, errQueueFull.Error(), l.Err)
+		require.Zero(t, l.Attempts)
+	}
+	dl.mu.Unlock()
+
+	close(release)
+	require.NoError(t, n.Close())
+}
+
+// TestCloseDeadline checks Close gives up on a webhook still failing once its
+// deadline is past, the payloads not delivered go to the dead letters.
+func TestCloseDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	dl := &deadLetters{}
+	n := New([]config.Webhook{{Name: "down", URL: server.URL, Secret: "s", MaxAttempts: 100, Backoff: time.Hour}}, dl)
+	n.closeTimeout = 50 * time.Millisecond
+	require.NoError(t, n.Write(sink.Batch{Ops: []types.Operation{newOp(types.OpMint, "a", ""), newOp(types.OpMint, "b", ""), newOp(types.OpMint, "c", "")}}))
+
+	start := time.Now()
+	require.NoError(t, n.Close())
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	require.Len(t, dl.letters, 3)
+	require.Equal(t, "minta:0", dl.letters[0].Delivery)
+	require.Equal(t, 1, dl.letters[0].Attempts)
+	for _, l := range dl.letters {
+		require.Equal(t, errClosed.Error(), l.Err)
+	}
+}